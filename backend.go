@@ -0,0 +1,57 @@
+//
+// Copyright © 2022 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package iterator
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// The iterators only need trie nodes from a plain key-value store, so any ethdb.KeyValueStore
+// backend can be used, e.g. memorydb or a Pebble store. Note that the pinned go-ethereum release
+// does not ship a Pebble backend itself.
+
+// OpenTrieFromStore opens the state trie at root from a key-value store
+func OpenTrieFromStore(kv ethdb.KeyValueStore, root common.Hash) (state.Trie, error) {
+	return state.NewDatabase(rawdb.NewDatabase(kv)).OpenTrie(root)
+}
+
+// NewSubtrieIteratorFactoryFromStore cuts the state trie at root within a key-value store into
+// `nbins` bins
+func NewSubtrieIteratorFactoryFromStore(kv ethdb.KeyValueStore, root common.Hash, nbins uint) (SubtrieIteratorFactory, error) {
+	tree, err := OpenTrieFromStore(kv, root)
+	if err != nil {
+		return SubtrieIteratorFactory{}, err
+	}
+	return NewSubtrieIteratorFactory(tree, nbins), nil
+}
+
+// CopyStateToMemory copies a state trie into a new in-memory database, importing `nbins` bins in
+// parallel, and returns the database along with the trie opened from it
+func CopyStateToMemory(tree state.Trie, nbins uint) (ethdb.Database, state.Trie, error) {
+	db := rawdb.NewMemoryDatabase()
+	if _, err := ImportSubtries(NewSubtrieIteratorFactory(tree, nbins), db); err != nil {
+		return nil, nil, err
+	}
+	copied, err := OpenTrieFromStore(db, tree.Hash())
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, copied, nil
+}
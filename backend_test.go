@@ -0,0 +1,38 @@
+package iterator_test
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/trie"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+)
+
+func TestCopyStateToMemory(t *testing.T) {
+	_, tree := newTestTrie(t, 500, 1)
+	db, copied, err := iter.CopyStateToMemory(tree, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied.Hash() != tree.Hash() {
+		t.Fatal("wrong root for copied trie")
+	}
+	fac, err := iter.NewSubtrieIteratorFactoryFromStore(db, tree.Hash(), 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected [][]byte
+	for it := tree.NodeIterator(nil); it.Next(true); {
+		expected = append(expected, append([]byte{}, it.Path()...))
+	}
+	var iters []trie.NodeIterator
+	for b := uint(0); b < uint(fac.Length()); b++ {
+		iters = append(iters, fac.IteratorAt(b))
+	}
+	checkRangeCoverage(t, iters, iter.MakeRanges(nil, 32), expected)
+
+	if _, err := iter.OpenTrieFromStore(rawdb.NewMemoryDatabase(), tree.Hash()); err == nil {
+		t.Fatal("expected error opening missing root")
+	}
+}
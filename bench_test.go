@@ -0,0 +1,120 @@
+package iterator_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/trie"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+	"github.com/vulcanize/go-eth-state-node-iterator/fixture/synth"
+)
+
+var (
+	benchSizes = []int{1e4, 1e5, 1e6}
+	benchBins  = []uint{1, 2, 4, 8, 16, 32, 64}
+
+	benchMu    sync.Mutex
+	benchTries = make(map[int]*synth.State)
+)
+
+// returns the synthetic state of a size, generating it once per process
+func benchState(b *testing.B, nleaves int) (state.Trie, int) {
+	if nleaves >= 1e6 && testing.Short() {
+		b.Skip("skipping large trie in short mode")
+	}
+	benchMu.Lock()
+	defer benchMu.Unlock()
+	st, has := benchTries[nleaves]
+	if !has {
+		var err error
+		if st, err = synth.Generate(synth.Config{Seed: 1, Accounts: nleaves}); err != nil {
+			b.Fatal(err)
+		}
+		benchTries[nleaves] = st
+	}
+	tree, err := st.OpenTrie()
+	if err != nil {
+		b.Fatal(err)
+	}
+	return tree, len(st.Accounts.Paths)
+}
+
+func reportNodeRate(b *testing.B, nodes int, elapsed time.Duration) {
+	b.ReportMetric(float64(nodes)*float64(b.N)/elapsed.Seconds(), "nodes/s")
+}
+
+func drain(b *testing.B, it trie.NodeIterator) {
+	for it.Next(true) {
+	}
+	if err := it.Error(); err != nil {
+		b.Error(err)
+	}
+}
+
+func BenchmarkSingleIterator(b *testing.B) {
+	for _, nleaves := range benchSizes {
+		b.Run(fmt.Sprintf("leaves=%d", nleaves), func(b *testing.B) {
+			tree, nodes := benchState(b, nleaves)
+			b.ReportAllocs()
+			b.ResetTimer()
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				drain(b, tree.NodeIterator(nil))
+			}
+			reportNodeRate(b, nodes, time.Since(start))
+		})
+	}
+}
+
+// Each bin's iterator runs in its own goroutine
+func BenchmarkSubtrieIterators(b *testing.B) {
+	for _, nleaves := range benchSizes {
+		for _, nbins := range benchBins {
+			b.Run(fmt.Sprintf("leaves=%d/bins=%d", nleaves, nbins), func(b *testing.B) {
+				tree, nodes := benchState(b, nleaves)
+				fac := iter.NewSubtrieIteratorFactory(tree, nbins)
+				b.ReportAllocs()
+				b.ResetTimer()
+				start := time.Now()
+				for i := 0; i < b.N; i++ {
+					var wg sync.WaitGroup
+					for bin := uint(0); bin < nbins; bin++ {
+						wg.Add(1)
+						go func(bin uint) {
+							defer wg.Done()
+							drain(b, fac.IteratorAt(bin))
+						}(bin)
+					}
+					wg.Wait()
+				}
+				reportNodeRate(b, nodes, time.Since(start))
+			})
+		}
+	}
+}
+
+// Bins are driven by the sink runner's worker pool into a counting sink
+func BenchmarkSinkRunner(b *testing.B) {
+	for _, nleaves := range benchSizes {
+		for _, nbins := range benchBins {
+			b.Run(fmt.Sprintf("leaves=%d/bins=%d", nleaves, nbins), func(b *testing.B) {
+				tree, nodes := benchState(b, nleaves)
+				fac := iter.NewSubtrieIteratorFactory(tree, nbins)
+				b.ReportAllocs()
+				b.ResetTimer()
+				start := time.Now()
+				for i := 0; i < b.N; i++ {
+					if err := iter.NewSinkRunner(&fac, iter.NewCountingSink()).Run(context.Background()); err != nil {
+						b.Fatal(err)
+					}
+				}
+				reportNodeRate(b, nodes, time.Since(start))
+			})
+		}
+	}
+}
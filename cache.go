@@ -0,0 +1,188 @@
+//
+// Copyright © 2022 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package iterator
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+const cacheShards = 16
+
+// CacheStats are the counters of a CachingStore
+type CacheStats struct {
+	Hits, Misses, Evictions uint64
+	// Reads which missed the cache but waited on another reader's fetch of the same node
+	Shared uint64
+	// Number and total size of cached entries
+	Entries, Bytes uint64
+}
+
+// CachingStore is a key-value store wrapper which caches trie nodes, so that bins iterating in
+// parallel share their reads of the upper levels of the trie. Only hash-keyed reads are cached:
+// these are content-addressed, so entries never need to be invalidated. It is safe for concurrent
+// use, and is sharded to limit contention; concurrent misses on the same node share a single read.
+//
+// Layered over a ThrottledStore, only the reads which miss the cache are paced.
+type CachingStore struct {
+	ethdb.KeyValueStore
+	shards               [cacheShards]cacheShard
+	hits, misses, shared uint64
+}
+
+// a size-limited LRU cache
+type cacheShard struct {
+	mu        sync.Mutex
+	entries   map[common.Hash]*list.Element
+	lru       list.List // front is most recent
+	size, max uint64
+	evictions uint64
+	pending   map[common.Hash]*pendingRead
+}
+
+// a read in progress, which other readers of the same key wait on
+type pendingRead struct {
+	done  chan struct{}
+	value []byte
+	err   error
+}
+
+type cacheEntry struct {
+	key   common.Hash
+	value []byte
+}
+
+// NewCachingStore wraps a store with a node cache holding up to maxBytes of node data
+func NewCachingStore(db ethdb.KeyValueStore, maxBytes uint64) *CachingStore {
+	s := &CachingStore{KeyValueStore: db}
+	for i := range s.shards {
+		s.shards[i].entries = make(map[common.Hash]*list.Element)
+		s.shards[i].pending = make(map[common.Hash]*pendingRead)
+		s.shards[i].max = maxBytes / cacheShards
+	}
+	return s
+}
+
+func (s *CachingStore) Get(key []byte) ([]byte, error) {
+	if len(key) != common.HashLength {
+		return s.KeyValueStore.Get(key)
+	}
+	hash := common.BytesToHash(key)
+	shard := &s.shards[hash[0]%cacheShards]
+
+	shard.mu.Lock()
+	if value, has := shard.get(hash); has {
+		shard.mu.Unlock()
+		atomic.AddUint64(&s.hits, 1)
+		return value, nil
+	}
+	if read, has := shard.pending[hash]; has {
+		shard.mu.Unlock()
+		atomic.AddUint64(&s.shared, 1)
+		<-read.done
+		return read.value, read.err
+	}
+	read := &pendingRead{done: make(chan struct{})}
+	shard.pending[hash] = read
+	shard.mu.Unlock()
+
+	atomic.AddUint64(&s.misses, 1)
+	read.value, read.err = s.KeyValueStore.Get(key)
+
+	shard.mu.Lock()
+	if read.err == nil {
+		shard.add(hash, read.value)
+	}
+	delete(shard.pending, hash)
+	shard.mu.Unlock()
+	close(read.done)
+	return read.value, read.err
+}
+
+func (s *CachingStore) Has(key []byte) (bool, error) {
+	if len(key) == common.HashLength {
+		hash := common.BytesToHash(key)
+		shard := &s.shards[hash[0]%cacheShards]
+		shard.mu.Lock()
+		_, has := shard.get(hash)
+		shard.mu.Unlock()
+		if has {
+			return true, nil
+		}
+	}
+	return s.KeyValueStore.Has(key)
+}
+
+// cached returns a cached node without reading the store or counting a hit
+func (s *CachingStore) cached(hash common.Hash) ([]byte, bool) {
+	shard := &s.shards[hash[0]%cacheShards]
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	elem, has := shard.entries[hash]
+	if !has {
+		return nil, false
+	}
+	return elem.Value.(*cacheEntry).value, true
+}
+
+// Stats returns the cache counters
+func (s *CachingStore) Stats() CacheStats {
+	stats := CacheStats{
+		Hits:   atomic.LoadUint64(&s.hits),
+		Misses: atomic.LoadUint64(&s.misses),
+		Shared: atomic.LoadUint64(&s.shared),
+	}
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.Lock()
+		stats.Evictions += shard.evictions
+		stats.Entries += uint64(len(shard.entries))
+		stats.Bytes += shard.size
+		shard.mu.Unlock()
+	}
+	return stats
+}
+
+// get and add must be called with the lock held
+func (c *cacheShard) get(key common.Hash) ([]byte, bool) {
+	elem, has := c.entries[key]
+	if !has {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).value, true
+}
+
+func (c *cacheShard) add(key common.Hash, value []byte) {
+	size := uint64(len(value))
+	if _, has := c.entries[key]; has || size > c.max {
+		return
+	}
+	for c.size+size > c.max {
+		oldest := c.lru.Back()
+		entry := c.lru.Remove(oldest).(*cacheEntry)
+		delete(c.entries, entry.key)
+		c.size -= uint64(len(entry.value))
+		c.evictions++
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, value: copyBytes(value)})
+	c.size += size
+}
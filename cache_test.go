@@ -0,0 +1,107 @@
+package iterator_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+)
+
+// a store whose reads block until released
+type blockingStore struct {
+	ethdb.KeyValueStore
+	started, release chan struct{}
+}
+
+func (s *blockingStore) Get(key []byte) ([]byte, error) {
+	s.started <- struct{}{}
+	<-s.release
+	return s.KeyValueStore.Get(key)
+}
+
+func TestCachingStore(t *testing.T) {
+	_, tree := newTestTrie(t, 1000, 1)
+	db, _, err := iter.CopyStateToMemory(tree, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nodes uint64
+	for it := tree.NodeIterator(nil); it.Next(true); {
+		if it.Hash() != (common.Hash{}) {
+			nodes++
+		}
+	}
+
+	reads := &countingLimiter{}
+	cache := iter.NewCachingStore(iter.NewThrottledStore(context.Background(), db, reads), 1<<24)
+	fac, err := iter.NewSubtrieIteratorFactoryFromStore(cache, tree.Hash(), 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := iter.NewSinkRunner(&fac, iter.NewCountingSink()).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	stats := cache.Stats()
+	if stats.Hits == 0 {
+		t.Fatal("expected cache hits from shared upper nodes")
+	}
+	if stats.Misses > nodes {
+		t.Fatalf("nodes read more than once: %d reads of %d nodes", stats.Misses, nodes)
+	}
+	if uint64(reads.count) != stats.Misses {
+		t.Fatalf("wrong store reads; expected %d, have %d", stats.Misses, reads.count)
+	}
+
+	t.Run("shared", func(t *testing.T) {
+		store := &blockingStore{KeyValueStore: db, started: make(chan struct{}, 2), release: make(chan struct{})}
+		cache := iter.NewCachingStore(store, 1<<20)
+		key := tree.Hash().Bytes()
+		var wg sync.WaitGroup
+		get := func() {
+			defer wg.Done()
+			if _, err := cache.Get(key); err != nil {
+				t.Error(err)
+			}
+		}
+		wg.Add(2)
+		go get()
+		<-store.started
+		go get()
+		// wait for the second read to join the first
+		for cache.Stats().Shared == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		close(store.release)
+		wg.Wait()
+		if stats := cache.Stats(); stats.Hits != 0 || stats.Misses != 1 || stats.Shared != 1 {
+			t.Fatalf("wrong stats: %+v", stats)
+		}
+		if len(store.started) != 0 {
+			t.Fatal("node read more than once")
+		}
+	})
+
+	t.Run("eviction", func(t *testing.T) {
+		const max = 1 << 12
+		cache := iter.NewCachingStore(db, max)
+		fac, err := iter.NewSubtrieIteratorFactoryFromStore(cache, tree.Hash(), 16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := iter.NewSinkRunner(&fac, iter.NewVerifyingSink()).Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		stats := cache.Stats()
+		if stats.Evictions == 0 {
+			t.Fatal("expected evictions")
+		}
+		if stats.Bytes > max {
+			t.Fatalf("cache over limit: %d bytes", stats.Bytes)
+		}
+	})
+}
@@ -0,0 +1,185 @@
+//
+// Copyright © 2022 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package iterator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Multicodec codes for Ethereum trie nodes
+const (
+	StateTrieCodec   uint64 = 0x96
+	StorageTrieCodec uint64 = 0x98
+
+	keccak256Multihash uint64 = 0x1b
+)
+
+// NodeCID returns the binary CIDv1 of a trie node, using its hash as the keccak-256 multihash digest
+func NodeCID(codec uint64, hash common.Hash) []byte {
+	buf := make([]byte, 0, 4*binary.MaxVarintLen64+common.HashLength)
+	buf = appendUvarint(buf, 1)
+	buf = appendUvarint(buf, codec)
+	buf = appendUvarint(buf, keccak256Multihash)
+	buf = appendUvarint(buf, common.HashLength)
+	return append(buf, hash.Bytes()...)
+}
+
+func appendUvarint(buf []byte, x uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], x)
+	return append(buf, tmp[:n]...)
+}
+
+// CARWriter writes blocks in the CARv1 format. It is safe for concurrent use.
+type CARWriter struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+// NewCARWriter writes a CARv1 header with a single root and returns a writer for its blocks
+func NewCARWriter(w io.Writer, root []byte) (*CARWriter, error) {
+	cw := &CARWriter{w: bufio.NewWriter(w)}
+	if err := cw.writeSection(carHeader(root)); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+// Put writes a single block
+func (cw *CARWriter) Put(cid, data []byte) error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	return cw.writeSection(cid, data)
+}
+
+// Flush writes any buffered blocks to the underlying writer
+func (cw *CARWriter) Flush() error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	return cw.w.Flush()
+}
+
+// writes a varint length-prefixed section
+func (cw *CARWriter) writeSection(parts ...[]byte) error {
+	var size uint64
+	for _, part := range parts {
+		size += uint64(len(part))
+	}
+	if _, err := cw.w.Write(appendUvarint(nil, size)); err != nil {
+		return err
+	}
+	for _, part := range parts {
+		if _, err := cw.w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DAG-CBOR encoding of {"roots": [root], "version": 1}
+func carHeader(root []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(0xa2) // map(2)
+	buf.WriteByte(0x65) // text(5)
+	buf.WriteString("roots")
+	buf.WriteByte(0x81)         // array(1)
+	buf.Write([]byte{0xd8, 42}) // tag(42): CID
+	writeCBORBytesHeader(&buf, len(root)+1)
+	buf.WriteByte(0) // multibase identity prefix
+	buf.Write(root)
+	buf.WriteByte(0x67) // text(7)
+	buf.WriteString("version")
+	buf.WriteByte(0x01)
+	return buf.Bytes()
+}
+
+func writeCBORBytesHeader(buf *bytes.Buffer, n int) {
+	const major = 0x40
+	switch {
+	case n < 24:
+		buf.WriteByte(major | byte(n))
+	case n < 1<<8:
+		buf.Write([]byte{major | 24, byte(n)})
+	default:
+		buf.Write([]byte{major | 25, byte(n >> 8), byte(n)})
+	}
+}
+
+// ExportCAR writes every standalone node yielded by an iterator to a CAR as a block of the given
+// codec. Returns the number of blocks written.
+func ExportCAR(it trie.NodeIterator, codec uint64, cw *CARWriter) (uint64, error) {
+	var count uint64
+	for it.Next(true) {
+		if bound, ok := it.(*PrefixBoundIterator); ok && bound.AtSharedBoundary() {
+			continue // the next bin will export it
+		}
+		hash := it.Hash()
+		if hash == (common.Hash{}) {
+			continue
+		}
+		blob := it.NodeBlob()
+		if blob == nil {
+			break
+		}
+		if err := cw.Put(NodeCID(codec, hash), blob); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, it.Error()
+}
+
+// ExportSubtriesCAR exports the trie covered by a factory into CAR files under dir, rooted at the
+// trie root, with blocks of the given codec: StateTrieCodec for a state trie, or StorageTrieCodec
+// for a storage trie. If merged is set all bins are written to a single state.car or storage.car,
+// otherwise each bin is written to its own bin-<n>.car. Bins are exported concurrently.
+func ExportSubtriesCAR(fac SubtrieIteratorFactory, codec uint64, dir string, merged bool) (uint64, error) {
+	root := NodeCID(codec, fac.tree.Hash())
+	counter := NewCountingSink()
+	if !merged {
+		err := NewSinkRunner(&fac, NewBinCARSink(dir, root, codec), counter).Run(context.Background())
+		return counter.Nodes(), err
+	}
+
+	name := "state.car"
+	if codec == StorageTrieCodec {
+		name = "storage.car"
+	}
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	cw, err := NewCARWriter(f, root)
+	if err != nil {
+		return 0, err
+	}
+	if err = NewSinkRunner(&fac, NewCARSink(cw, codec), counter).Run(context.Background()); err != nil {
+		return counter.Nodes(), err
+	}
+	return counter.Nodes(), f.Sync()
+}
@@ -0,0 +1,119 @@
+package iterator_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+)
+
+// length of a binary trie node CID: version, 2-byte codec, multihash code and length, digest
+const cidLength = 5 + common.HashLength
+
+// reads the sections of a CARv1 file, returning the header and the blocks keyed by CID
+func readCAR(t *testing.T, path string) ([]byte, map[string][]byte) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sections [][]byte
+	for len(data) > 0 {
+		size, n := binary.Uvarint(data)
+		if n <= 0 || uint64(len(data)-n) < size {
+			t.Fatalf("malformed CAR section in %s", path)
+		}
+		sections = append(sections, data[n:n+int(size)])
+		data = data[n+int(size):]
+	}
+	if len(sections) == 0 {
+		t.Fatalf("empty CAR %s", path)
+	}
+	blocks := make(map[string][]byte)
+	for _, sec := range sections[1:] {
+		cid, blob := sec[:cidLength], sec[cidLength:]
+		if _, has := blocks[string(cid)]; has {
+			t.Fatalf("duplicate block %x", cid)
+		}
+		blocks[string(cid)] = blob
+	}
+	return sections[0], blocks
+}
+
+func TestExportSubtriesCAR(t *testing.T) {
+	_, tree := newTestTrie(t, 1000, 1)
+	sdb, root := newTestStateWithStorage(t, []int{1000})
+	statedb, err := state.New(root, sdb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := statedb.StorageTrie(common.BigToAddress(big.NewInt(0)))
+	if storage == nil {
+		t.Fatal("missing storage trie")
+	}
+	t.Run("state", func(t *testing.T) { testExportSubtriesCAR(t, tree, iter.StateTrieCodec, "state.car") })
+	t.Run("storage", func(t *testing.T) { testExportSubtriesCAR(t, storage, iter.StorageTrieCodec, "storage.car") })
+}
+
+func testExportSubtriesCAR(t *testing.T, tree state.Trie, codec uint64, merged string) {
+	expected := make(map[string]bool)
+	for it := tree.NodeIterator(nil); it.Next(true); {
+		if it.Hash() != (common.Hash{}) {
+			expected[string(iter.NodeCID(codec, it.Hash()))] = true
+		}
+	}
+	root := iter.NodeCID(codec, tree.Hash())
+
+	check := func(t *testing.T, header []byte, blocks map[string][]byte) {
+		if !bytes.Contains(header, root) {
+			t.Fatalf("header does not contain root CID")
+		}
+		for cid, blob := range blocks {
+			if !expected[cid] {
+				t.Fatalf("unexpected CID %x", cid)
+			}
+			if !bytes.Equal([]byte(cid)[cidLength-common.HashLength:], crypto.Keccak256(blob)) {
+				t.Fatalf("CID %x does not match block hash", cid)
+			}
+		}
+	}
+
+	t.Run("merged", func(t *testing.T) {
+		dir := t.TempDir()
+		if _, err := iter.ExportSubtriesCAR(iter.NewSubtrieIteratorFactory(tree, 32), codec, dir, true); err != nil {
+			t.Fatal(err)
+		}
+		header, blocks := readCAR(t, filepath.Join(dir, merged))
+		check(t, header, blocks)
+		if len(blocks) != len(expected) {
+			t.Fatalf("wrong block count; expected %d, have %d", len(expected), len(blocks))
+		}
+	})
+
+	t.Run("per bin", func(t *testing.T) {
+		dir := t.TempDir()
+		fac := iter.NewSubtrieIteratorFactory(tree, 16)
+		if _, err := iter.ExportSubtriesCAR(fac, codec, dir, false); err != nil {
+			t.Fatal(err)
+		}
+		all := make(map[string]bool)
+		for b := 0; b < fac.Length(); b++ {
+			header, blocks := readCAR(t, filepath.Join(dir, fmt.Sprintf("bin-%d.car", b)))
+			check(t, header, blocks)
+			for cid := range blocks {
+				all[cid] = true
+			}
+		}
+		if len(all) != len(expected) {
+			t.Fatalf("wrong block count; expected %d, have %d", len(expected), len(all))
+		}
+	})
+}
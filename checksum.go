@@ -0,0 +1,144 @@
+//
+// Copyright © 2022 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package iterator
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// BinChecksum is a digest of the leaves within a bin. Chain depends on the order in which leaves
+// are visited, and identifies the bin's exact contents. Sum is additive, so the checksums of any
+// partition of the trie combine to the same global checksum; as a modular sum of hashes it is
+// weaker than Chain, and bins should be compared by Chain.
+type BinChecksum struct {
+	Leaves uint64
+	// Running hash over each leaf hash, in iteration order
+	Chain common.Hash
+	// Sum modulo 2^256 of the leaf hashes
+	Sum common.Hash
+
+	lastKey []byte
+}
+
+var two256 = new(big.Int).Lsh(common.Big1, 256)
+
+// leaf hash is keccak(len(key) || key || value)
+func (c *BinChecksum) add(key, value []byte) error {
+	if c.lastKey != nil && bytes.Compare(c.lastKey, key) >= 0 {
+		return fmt.Errorf("%w: leaf %x follows %x", ErrPathOrder, key, c.lastKey)
+	}
+	c.lastKey = append(c.lastKey[:0], key...)
+
+	var keyLen [2]byte
+	binary.BigEndian.PutUint16(keyLen[:], uint16(len(key)))
+	leaf := crypto.Keccak256(keyLen[:], key, value)
+	c.Chain = crypto.Keccak256Hash(c.Chain.Bytes(), leaf)
+	sum := new(big.Int).SetBytes(c.Sum.Bytes())
+	sum.Add(sum, new(big.Int).SetBytes(leaf)).Mod(sum, two256)
+	c.Sum = common.BigToHash(sum)
+	c.Leaves++
+	return nil
+}
+
+// CombineChecksums returns the global checksum of a set of bins, which is independent of how the
+// trie was partitioned
+func CombineChecksums(bins []BinChecksum) common.Hash {
+	var (
+		leaves uint64
+		sum    = new(big.Int)
+	)
+	for _, bin := range bins {
+		leaves += bin.Leaves
+		sum.Add(sum, new(big.Int).SetBytes(bin.Sum.Bytes()))
+	}
+	sum.Mod(sum, two256)
+	var count [8]byte
+	binary.BigEndian.PutUint64(count[:], leaves)
+	return crypto.Keccak256Hash(count[:], common.BigToHash(sum).Bytes())
+}
+
+// LeafChecksum computes the checksum of the leaves yielded by a single iterator
+func LeafChecksum(it trie.NodeIterator) (BinChecksum, error) {
+	var sum BinChecksum
+	for it.Next(true) {
+		if !it.Leaf() {
+			continue
+		}
+		if err := sum.add(it.LeafKey(), it.LeafBlob()); err != nil {
+			return sum, err
+		}
+	}
+	return sum, it.Error()
+}
+
+// ChecksumSink computes the checksum of each bin's leaves
+type ChecksumSink struct {
+	NopSink
+	mu   sync.Mutex
+	bins map[uint]*BinChecksum
+}
+
+func NewChecksumSink() *ChecksumSink {
+	return &ChecksumSink{bins: make(map[uint]*BinChecksum)}
+}
+
+func (s *ChecksumSink) OnBinStart(bin uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bins[bin] = &BinChecksum{}
+	return nil
+}
+
+func (s *ChecksumSink) OnLeaf(bin uint, leaf Leaf) error {
+	s.mu.Lock()
+	sum := s.bins[bin]
+	s.mu.Unlock()
+	return sum.add(leaf.Key, leaf.Value)
+}
+
+// Bins returns the checksums of the first n bins
+func (s *ChecksumSink) Bins(n int) []BinChecksum {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := make([]BinChecksum, n)
+	for b := range res {
+		if sum, has := s.bins[uint(b)]; has {
+			res[b] = *sum
+		}
+	}
+	return res
+}
+
+// StateChecksum computes the per-bin and global checksums of the trie covered by a factory,
+// processing bins in parallel
+func StateChecksum(fac SubtrieIteratorFactory) (common.Hash, []BinChecksum, error) {
+	sink := NewChecksumSink()
+	if err := NewSinkRunner(&fac, sink).Run(context.Background()); err != nil {
+		return common.Hash{}, nil, err
+	}
+	bins := sink.Bins(fac.Length())
+	return CombineChecksums(bins), bins, nil
+}
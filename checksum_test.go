@@ -0,0 +1,68 @@
+package iterator_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+)
+
+func TestStateChecksum(t *testing.T) {
+	sdb, tree := newTestTrie(t, 1000, 1)
+	whole, err := iter.LeafChecksum(tree.NodeIterator(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := iter.CombineChecksums([]iter.BinChecksum{whole})
+
+	for _, nbins := range []uint{1, 2, 16, 32, 256} {
+		t.Run(fmt.Sprintf("%d bins", nbins), func(t *testing.T) {
+			fac := iter.NewSubtrieIteratorFactory(tree, nbins)
+			sum, bins, err := iter.StateChecksum(fac)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(bins) != int(nbins) {
+				t.Fatalf("wrong number of bin checksums: %d", len(bins))
+			}
+			// each bin's chain hash matches a sequential traversal of the bin
+			for b, bin := range bins {
+				seq, err := iter.LeafChecksum(fac.IteratorAt(uint(b)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if bin.Chain != seq.Chain || bin.Leaves != seq.Leaves {
+					t.Fatalf("bin %d: wrong chain hash; expected %x, have %x", b, seq.Chain, bin.Chain)
+				}
+				if bin.Leaves > 1 && bin.Chain == bin.Sum {
+					t.Fatalf("bin %d: chain hash equals sum", b)
+				}
+			}
+			if sum != expected {
+				t.Fatalf("checksum depends on bins; expected %x, have %x", expected, sum)
+			}
+		})
+	}
+
+	t.Run("modified state", func(t *testing.T) {
+		modified, err := sdb.OpenTrie(tree.Hash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := modified.TryUpdate([]byte("key"), []byte{1}); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := modified.Commit(nil); err != nil {
+			t.Fatal(err)
+		}
+		sum, _, err := iter.StateChecksum(iter.NewSubtrieIteratorFactory(modified, 16))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sum == expected || sum == (common.Hash{}) {
+			t.Fatal("checksum did not change with state")
+		}
+	})
+}
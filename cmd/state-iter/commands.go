@@ -0,0 +1,181 @@
+//
+// Copyright © 2022 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+)
+
+func runNodes(args []string) error {
+	opts, err := parseFlags("nodes", args)
+	if err != nil {
+		return err
+	}
+	tree, _, db, err := opts.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	out := bufio.NewWriter(stdout)
+	defer out.Flush()
+	iters := opts.iterators(tree)
+	for b, it := range iters {
+		// a node on a shared boundary is printed by the next bin, unless this is the last one
+		skipBoundary := !opts.bounded && b+1 < len(iters)
+		for it.Next(true) {
+			if skipBoundary && it.AtSharedBoundary() {
+				continue
+			}
+			switch {
+			case it.Leaf():
+				fmt.Fprintf(out, "%d\t%s\tleaf\t%x\n", b, iter.Path(it.Path()), it.LeafKey())
+			case it.Hash() == (common.Hash{}):
+				fmt.Fprintf(out, "%d\t%s\tembedded\n", b, iter.Path(it.Path()))
+			default:
+				fmt.Fprintf(out, "%d\t%s\tnode\t%x\n", b, iter.Path(it.Path()), it.Hash())
+			}
+		}
+		if err := it.Error(); err != nil {
+			return fmt.Errorf("bin %d: %w", b, err)
+		}
+	}
+	return nil
+}
+
+type binStats struct {
+	nodes, embedded, leaves uint64
+	maxDepth                int
+	first, last             []byte
+	err                     error
+}
+
+func runStats(args []string) error {
+	opts, err := parseFlags("stats", args)
+	if err != nil {
+		return err
+	}
+	tree, header, db, err := opts.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	begin := time.Now()
+	iters := opts.iterators(tree)
+	stats := make([]binStats, len(iters))
+	var wg sync.WaitGroup
+	for b := range iters {
+		wg.Add(1)
+		go func(b int) {
+			defer wg.Done()
+			st := &stats[b]
+			it := iters[b]
+			// a node on a shared boundary is counted by the next bin, unless this is the last one
+			skipBoundary := !opts.bounded && b+1 < len(iters)
+			for it.Next(true) {
+				if skipBoundary && it.AtSharedBoundary() {
+					continue
+				}
+				path := it.Path()
+				if st.first == nil {
+					st.first = append([]byte{}, path...)
+				}
+				st.last = append(st.last[:0], path...)
+				if len(path) > st.maxDepth {
+					st.maxDepth = len(path)
+				}
+				switch {
+				case it.Leaf():
+					st.leaves++
+				case it.Hash() == (common.Hash{}):
+					st.embedded++
+				default:
+					st.nodes++
+				}
+			}
+			st.err = it.Error()
+		}(b)
+	}
+	wg.Wait()
+
+	fmt.Fprintf(stdout, "block %d (%s), state root %s\n\n", header.Number, header.Hash().Hex(), header.Root.Hex())
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "bin\tnodes\tembedded\tleaves\tmax depth\tfirst\tlast\t")
+	var total binStats
+	for b, st := range stats {
+		if st.err != nil {
+			return fmt.Errorf("bin %d: %w", b, st.err)
+		}
+		fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%d\t%s\t%s\t\n",
+			b, st.nodes, st.embedded, st.leaves, st.maxDepth, iter.Path(st.first), iter.Path(st.last))
+		total.nodes += st.nodes
+		total.embedded += st.embedded
+		total.leaves += st.leaves
+		if st.maxDepth > total.maxDepth {
+			total.maxDepth = st.maxDepth
+		}
+	}
+	fmt.Fprintf(w, "total\t%d\t%d\t%d\t%d\t\t\t\n", total.nodes, total.embedded, total.leaves, total.maxDepth)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "\nelapsed %s\n", time.Since(begin).Round(time.Millisecond))
+	return nil
+}
+
+func runChecksum(args []string) error {
+	opts, err := parseFlags("checksum", args)
+	if err != nil {
+		return err
+	}
+	tree, _, db, err := opts.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var bins []iter.BinChecksum
+	if opts.bounded {
+		sum, err := iter.LeafChecksum(opts.iterators(tree)[0])
+		if err != nil {
+			return err
+		}
+		bins = []iter.BinChecksum{sum}
+	} else if _, bins, err = iter.StateChecksum(iter.NewSubtrieIteratorFactory(tree, opts.nbins)); err != nil {
+		return err
+	}
+	if len(bins) > 1 {
+		for b, sum := range bins {
+			fmt.Fprintf(stdout, "bin %d\t%s (%d leaves)\n", b, sum.Chain.Hex(), sum.Leaves)
+		}
+	}
+	var leaves uint64
+	for _, sum := range bins {
+		leaves += sum.Leaves
+	}
+	fmt.Fprintf(stdout, "%s (%d leaves)\n", iter.CombineChecksums(bins).Hex(), leaves)
+	return nil
+}
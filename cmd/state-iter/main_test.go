@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"strings"
+	"testing"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+	fixt "github.com/vulcanize/go-eth-state-node-iterator/fixture"
+	"github.com/vulcanize/go-eth-state-node-iterator/fixture/fixturetest"
+)
+
+// runs a command with its output captured
+func runCommand(t *testing.T, run func([]string) error, args ...string) (string, error) {
+	t.Helper()
+	var buf bytes.Buffer
+	defer func(w io.Writer) { stdout = w }(stdout)
+	stdout = &buf
+	err := run(args)
+	return buf.String(), err
+}
+
+func datasetArgs(t *testing.T, args ...string) []string {
+	return append([]string{"-chaindata", fixturetest.Path(t, "block1")}, args...)
+}
+
+func TestParseFlags(t *testing.T) {
+	valid := [][]string{
+		{"-chaindata", "db"},
+		{"-chaindata", "db", "-bins", "16"},
+		{"-chaindata", "db", "-start", "0a3"},
+		{"-chaindata", "db", "-start", "0a", "-end", "f"},
+	}
+	for _, args := range valid {
+		if _, err := parseFlags("test", args); err != nil {
+			t.Errorf("failed to parse %v: %v", args, err)
+		}
+	}
+	invalid := [][]string{
+		{},
+		{"-chaindata", "db", "-bins", "0"},
+		{"-chaindata", "db", "-bins", "3"},
+		{"-chaindata", "db", "-start", "0g"},
+		{"-chaindata", "db", "-end", "x"},
+		{"-chaindata", "db", "-bins", "2", "-start", "1"},
+		{"-chaindata", "db", "-nonexistent"},
+	}
+	for _, args := range invalid {
+		if _, err := parseFlags("test", args); err == nil {
+			t.Errorf("expected error parsing %v", args)
+		}
+	}
+
+	opts, err := parseFlags("test", []string{"-chaindata", "db", "-start", "0a3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !opts.bounded || !bytes.Equal(opts.startPath, []byte{0, 10, 3}) || opts.ancient != "db/ancient" {
+		t.Fatalf("wrong options: %+v", opts)
+	}
+	if _, err := parseFlags("test", []string{"-h"}); !errors.Is(err, flag.ErrHelp) {
+		t.Fatalf("expected ErrHelp, have %v", err)
+	}
+}
+
+func TestNodes(t *testing.T) {
+	out, err := runCommand(t, runNodes, datasetArgs(t, "-block", "1", "-bins", "32")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != len(fixt.Block1_Paths) {
+		t.Fatalf("wrong node count; expected %d, have %d", len(fixt.Block1_Paths), len(lines))
+	}
+	for i, line := range lines {
+		if path := strings.Split(line, "\t")[1]; path != iter.Path(fixt.Block1_Paths[i]).String() {
+			t.Fatalf("wrong path at line %d; expected %s, have %s", i, iter.Path(fixt.Block1_Paths[i]), path)
+		}
+	}
+
+	// an odd-length start is padded to the first key under it
+	out, err = runCommand(t, runNodes, datasetArgs(t, "-block", "1", "-start", "8", "-end", "9")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := strings.Split(out, "\t")[1]
+	if !strings.HasPrefix(first, "8") {
+		t.Fatalf("wrong first path: %s", first)
+	}
+
+	// a node on an even-length end is the last one visited, and is not skipped
+	out, err = runCommand(t, runNodes, datasetArgs(t, "-block", "1", "-end", "00")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines = strings.Split(strings.TrimSpace(out), "\n")
+	if last := strings.Split(lines[len(lines)-1], "\t")[1]; len(lines) != 3 || last != "00" {
+		t.Fatalf("wrong nodes for bounded range:\n%s", out)
+	}
+}
+
+func TestStats(t *testing.T) {
+	totals := map[string]bool{}
+	for _, bins := range []string{"1", "32"} {
+		out, err := runCommand(t, runStats, datasetArgs(t, "-bins", bins)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(out, "\n") {
+			if fields := strings.Fields(line); len(fields) > 0 && fields[0] == "total" {
+				totals[strings.Join(fields[1:], " ")] = true
+			}
+		}
+	}
+	// nodes on a shared boundary are counted once, so the totals agree
+	if len(totals) != 1 {
+		t.Fatalf("totals differ between bin counts: %v", totals)
+	}
+
+	// the node on an even-length end is counted
+	out, err := runCommand(t, runStats, datasetArgs(t, "-end", "00")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if fields := strings.Fields(line); len(fields) > 1 && fields[0] == "total" && fields[1] != "3" {
+			t.Fatalf("wrong node count for bounded range: %s", line)
+		}
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	var sums []string
+	for _, bins := range []string{"1", "16"} {
+		out, err := runCommand(t, runChecksum, datasetArgs(t, "-bins", bins)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		sums = append(sums, lines[len(lines)-1])
+	}
+	if sums[0] != sums[1] {
+		t.Fatalf("checksum depends on bin count: %v", sums)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	out, err := runCommand(t, runPlan, "-bins", "4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 5 {
+		t.Fatalf("wrong number of lines:\n%s", out)
+	}
+
+	out, err = runCommand(t, runPlan, datasetArgs(t, "-bins", "32", "-count")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	total := strings.Fields(lines[len(lines)-1])
+	if len(total) != 2 || total[0] != "total" {
+		t.Fatalf("wrong total line: %q", lines[len(lines)-1])
+	}
+
+	if _, err := runCommand(t, runPlan, "-bins", "3"); err == nil {
+		t.Fatal("expected error for invalid bin count")
+	}
+	if _, err := runCommand(t, runPlan, "-count"); err == nil {
+		t.Fatal("expected error for -count without -chaindata")
+	}
+	for _, args := range [][]string{
+		{"-start", "1"}, {"-end", "8"}, {"-block", "1"}, {"-chaindata", "db"}, {"-ancient", "db/ancient"},
+	} {
+		if _, err := runCommand(t, runPlan, args...); err == nil {
+			t.Errorf("expected error for %v", args)
+		}
+	}
+	if _, err := runCommand(t, runPlan, datasetArgs(t, "-block", "1", "-count")...); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,100 @@
+//
+// Copyright © 2022 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+)
+
+type options struct {
+	chaindata, ancient string
+	block              string
+	nbins              uint
+	start, end         string
+
+	startPath, endPath []byte
+	bounded            bool
+}
+
+func (opts *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&opts.chaindata, "chaindata", "", "path to the LevelDB chaindata directory (required)")
+	fs.StringVar(&opts.ancient, "ancient", "", "path to the ancient data directory (default <chaindata>/ancient)")
+	fs.StringVar(&opts.block, "block", "head", "block height, hash, \"head\" or \"finalized\"")
+	fs.UintVar(&opts.nbins, "bins", 1, "number of bins to cut the trie into (a power of 2)")
+	fs.StringVar(&opts.start, "start", "", "hex nibble path to start iteration from, e.g. 0a3")
+	fs.StringVar(&opts.end, "end", "", "hex nibble path to end iteration at (inclusive)")
+}
+
+func (opts *options) validate() error {
+	if opts.chaindata == "" {
+		return errors.New("-chaindata is required")
+	}
+	if opts.ancient == "" {
+		opts.ancient = filepath.Join(opts.chaindata, "ancient")
+	}
+	if _, err := iter.MakePathsE(nil, opts.nbins); err != nil {
+		return fmt.Errorf("-bins: %w", err)
+	}
+	var err error
+	if opts.startPath, err = iter.ParsePath(opts.start); err != nil {
+		return fmt.Errorf("-start: %w", err)
+	}
+	if opts.endPath, err = iter.ParsePath(opts.end); err != nil {
+		return fmt.Errorf("-end: %w", err)
+	}
+	opts.bounded = opts.start != "" || opts.end != ""
+	if opts.bounded && opts.nbins != 1 {
+		return errors.New("-bins cannot be combined with -start or -end")
+	}
+	return nil
+}
+
+// opens the state trie of the selected block
+func (opts *options) open() (state.Trie, *types.Header, ethdb.Database, error) {
+	sel, err := iter.ParseBlockSelector(opts.block)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return iter.OpenStateAt(opts.chaindata, opts.ancient, sel)
+}
+
+// returns the iterators to traverse: the bins of the trie, or a single bounded iterator
+func (opts *options) iterators(tree state.Trie) []*iter.PrefixBoundIterator {
+	if opts.bounded {
+		var end []byte
+		if opts.end != "" {
+			end = opts.endPath
+		}
+		it := tree.NodeIterator(iter.HexToKeyBytesPadded(opts.startPath))
+		return []*iter.PrefixBoundIterator{iter.NewPrefixBoundIterator(it, opts.startPath, end)}
+	}
+	fac := iter.NewSubtrieIteratorFactory(tree, opts.nbins)
+	iters := make([]*iter.PrefixBoundIterator, fac.Length())
+	for b := range iters {
+		iters[b] = fac.IteratorAt(uint(b))
+	}
+	return iters
+}
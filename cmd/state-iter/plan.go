@@ -0,0 +1,102 @@
+//
+// Copyright © 2022 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"text/tabwriter"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+)
+
+func runPlan(args []string) error {
+	var (
+		opts  options
+		count bool
+	)
+	fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+	opts.register(fs)
+	fs.BoolVar(&count, "count", false, "measure the nodes in each bin (requires -chaindata)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// the plan always covers the whole trie, and only -count reads the state
+	var unused error
+	fs.Visit(func(f *flag.Flag) {
+		switch {
+		case f.Name == "start" || f.Name == "end":
+			unused = fmt.Errorf("-%s is not supported by plan", f.Name)
+		case (f.Name == "block" || f.Name == "chaindata" || f.Name == "ancient") && !count:
+			unused = fmt.Errorf("-%s requires -count", f.Name)
+		}
+	})
+	if unused != nil {
+		return unused
+	}
+	ranges, err := iter.MakeRangesE(nil, opts.nbins)
+	if err != nil {
+		return fmt.Errorf("-bins: %w", err)
+	}
+
+	var counter *iter.CountingSink
+	if count {
+		if opts.chaindata == "" {
+			return errors.New("-count requires -chaindata")
+		}
+		if err := opts.validate(); err != nil {
+			return err
+		}
+		tree, _, db, err := opts.open()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		counter = iter.NewCountingSink()
+		fac := iter.NewSubtrieIteratorFactory(tree, opts.nbins)
+		if err := iter.NewSinkRunner(&fac, counter).Run(context.Background()); err != nil {
+			return err
+		}
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	header := "bin\tstart\tend\t"
+	if counter != nil {
+		header += "nodes\t"
+	}
+	fmt.Fprintln(w, header)
+	for b, r := range ranges {
+		fmt.Fprintf(w, "%d\t%s\t%s\t", b, formatBound(r.Start), formatBound(r.End))
+		if counter != nil {
+			fmt.Fprintf(w, "%d\t", counter.BinNodes(uint(b)))
+		}
+		fmt.Fprintln(w)
+	}
+	if counter != nil {
+		fmt.Fprintf(w, "total\t\t\t%d\t\n", counter.Nodes())
+	}
+	return w.Flush()
+}
+
+func formatBound(path []byte) string {
+	if path == nil {
+		return "nil"
+	}
+	return iter.Path(path).String()
+}
@@ -0,0 +1,84 @@
+package iterator_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/trie"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+	"github.com/vulcanize/go-eth-state-node-iterator/fixture/synth"
+)
+
+// Properties every partition must satisfy, whatever the trie, bin count and prefix:
+//   - the bins visit every node of the full traversal, in order
+//   - paths increase within each bin, and between bins
+//   - the only node visited twice is one lying exactly on an even-length bound between two bins
+func checkBinProperties(t testing.TB, seed int64, nleaves int, shape synth.Shape, nbins uint, prefix []byte) {
+	st, err := synth.Generate(synth.Config{Seed: seed, Accounts: nleaves, Shape: shape})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := st.OpenTrie()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ranges, err := iter.MakeRangesE(prefix, nbins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for b := 1; b < len(ranges); b++ {
+		if iter.ComparePositions(ranges[b-1].End, ranges[b].Start) != 0 {
+			t.Fatalf("ranges not conterminous at bin %d: %v", b, ranges)
+		}
+		if !bytes.HasPrefix(ranges[b].Start, prefix) {
+			t.Fatalf("range %d outside of prefix %v: %v", b, prefix, ranges[b])
+		}
+	}
+	checkRangeCoverage(t, rangeIterators(tree, ranges), ranges, st.Accounts.Paths)
+}
+
+func rangeIterators(tree state.Trie, ranges []iter.PathRange) []trie.NodeIterator {
+	var iters []trie.NodeIterator
+	for _, r := range ranges {
+		iters = append(iters, iter.NewPrefixBoundIterator(tree.NodeIterator(iter.HexToKeyBytesPadded(r.Start)), r.Start, r.End))
+	}
+	return iters
+}
+
+func TestBinProperties(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		seed := rng.Int63()
+		nleaves := rng.Intn(1000)
+		shape := synth.Shape(rng.Intn(3))
+		nbins := uint(1) << rng.Intn(13)
+		prefix := make([]byte, rng.Intn(4))
+		for j := range prefix {
+			prefix[j] = byte(rng.Intn(16))
+		}
+		checkBinProperties(t, seed, nleaves, shape, nbins, prefix)
+		if t.Failed() {
+			t.Logf("failed with seed=%d leaves=%d shape=%v nbins=%d prefix=%v", seed, nleaves, shape, nbins, prefix)
+			return
+		}
+	}
+}
+
+func FuzzBinCoverage(f *testing.F) {
+	f.Add(int64(1), uint16(100), uint8(0), uint8(4), []byte{})
+	f.Add(int64(2), uint16(500), uint8(1), uint8(5), []byte{3})
+	f.Add(int64(3), uint16(300), uint8(2), uint8(8), []byte{15, 0})
+	f.Add(int64(4), uint16(0), uint8(0), uint8(1), []byte{8})
+	f.Fuzz(func(t *testing.T, seed int64, nleaves uint16, shape uint8, binsLog uint8, prefix []byte) {
+		if len(prefix) > 4 {
+			prefix = prefix[:4]
+		}
+		for i := range prefix {
+			prefix[i] &= 0xf
+		}
+		checkBinProperties(t, seed, int(nleaves%2000), synth.Shape(shape%3), uint(1)<<(binsLog%13), prefix)
+	})
+}
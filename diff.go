@@ -0,0 +1,65 @@
+//
+// Copyright © 2022 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package iterator
+
+import (
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// DiffIteratorFactory cuts a trie into bins which visit only its nodes that are not present in a
+// base trie, as trie.NewDifferenceIterator does. Both tries are seeked to each bin's start, and
+// subtries with the same hash at the same path are skipped, so each bin only reads the changed part
+// of its range. The bins have the same bounds as those of NewSubtrieIteratorFactory. Since its bins
+// do not hold every leaf, it is a distinct type from SubtrieIteratorFactory, and can only be used
+// where a BinIteratorFactory is accepted, e.g. with a SinkRunner.
+type DiffIteratorFactory struct {
+	base state.Trie
+	fac  SubtrieIteratorFactory
+}
+
+// NewDiffIteratorFactory cuts a trie into `nbins` bins which visit only its nodes not in base
+func NewDiffIteratorFactory(base, tree state.Trie, nbins uint) (DiffIteratorFactory, error) {
+	fac, err := NewSubtrieIteratorFactoryE(tree, nbins)
+	if err != nil {
+		return DiffIteratorFactory{}, err
+	}
+	return DiffIteratorFactory{base: base, fac: fac}, nil
+}
+
+// NewChangedNodesFactory cuts the state trie of a block into `nbins` bins visiting only the nodes
+// which are not in its parent's state trie
+func NewChangedNodesFactory(sdb state.Database, parent, child *types.Header, nbins uint) (DiffIteratorFactory, error) {
+	base, err := sdb.OpenTrie(parent.Root)
+	if err != nil {
+		return DiffIteratorFactory{}, err
+	}
+	tree, err := sdb.OpenTrie(child.Root)
+	if err != nil {
+		return DiffIteratorFactory{}, err
+	}
+	return NewDiffIteratorFactory(base, tree, nbins)
+}
+
+func (fac *DiffIteratorFactory) Length() int { return fac.fac.Length() }
+
+func (fac *DiffIteratorFactory) IteratorAt(bin uint) *PrefixBoundIterator {
+	start := HexToKeyBytes(fac.fac.startPaths[bin])
+	it, _ := trie.NewDifferenceIterator(copyTrie(fac.base).NodeIterator(start), fac.fac.treeCopy().NodeIterator(start))
+	return NewPrefixBoundIterator(it, fac.fac.startPaths[bin], fac.fac.endPaths[bin])
+}
@@ -0,0 +1,79 @@
+package iterator_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/trie"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+)
+
+func TestChangedNodesFactory(t *testing.T) {
+	db, headers := newTestChain(t, 3, 300)
+	sdb := state.NewDatabase(db)
+	parent, err := sdb.OpenTrie(headers[1].Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := sdb.OpenTrie(headers[2].Root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the unpartitioned difference is the expected result
+	var expected [][]byte
+	var expectedNodes, expectedLeaves uint64
+	diff, _ := trie.NewDifferenceIterator(parent.NodeIterator(nil), child.NodeIterator(nil))
+	for diff.Next(true) {
+		expected = append(expected, append([]byte{}, diff.Path()...))
+		if diff.Leaf() {
+			expectedLeaves++
+		} else if diff.Hash() != (common.Hash{}) {
+			expectedNodes++
+		}
+	}
+	if len(expected) == 0 {
+		t.Fatal("no changed nodes")
+	}
+
+	for _, nbins := range []uint{1, 2, 16, 32, 256} {
+		t.Run(fmt.Sprintf("%d bins", nbins), func(t *testing.T) {
+			fac, err := iter.NewChangedNodesFactory(sdb, headers[1], headers[2], nbins)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var iters []trie.NodeIterator
+			for b := uint(0); b < nbins; b++ {
+				iters = append(iters, fac.IteratorAt(b))
+			}
+			checkRangeCoverage(t, iters, iter.MakeRanges(nil, nbins), expected)
+
+			counter := iter.NewCountingSink()
+			if err := iter.NewSinkRunner(&fac, counter).Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if counter.Nodes() != expectedNodes || counter.Leaves() != expectedLeaves {
+				t.Fatalf("wrong counts; expected %d nodes and %d leaves, have %d and %d",
+					expectedNodes, expectedLeaves, counter.Nodes(), counter.Leaves())
+			}
+		})
+	}
+
+	if _, err := iter.NewDiffIteratorFactory(parent, child, 3); !errors.Is(err, iter.ErrInvalidBinCount) {
+		t.Fatalf("expected ErrInvalidBinCount, have %v", err)
+	}
+	// identical tries have no difference
+	same, err := iter.NewDiffIteratorFactory(child, child, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for b := uint(0); b < uint(same.Length()); b++ {
+		if it := same.IteratorAt(b); it.Next(true) {
+			t.Fatalf("unexpected node in bin %d: %v", b, it.Path())
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package iterator
+
+import "time"
+
+// SetClock replaces the time source used to refill tokens
+func (l *RateLimiter) SetClock(now func() time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.now = now
+	l.last = now()
+}
+
+// SetClock replaces the time source used to refill tokens and pace adjustments
+func (a *AdaptiveLimiter) SetClock(now func() time.Time) {
+	a.RateLimiter.SetClock(now)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.lastAdjust = now()
+}
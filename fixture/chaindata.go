@@ -1,15 +1,12 @@
 package fixture
 
 import (
-	"os"
 	"path/filepath"
 	"runtime"
 )
 
-// TODO: embed some mainnet data
-// import "embed"
-//_go:embed mainnet_data.tar.gz
-
+// Paths of the checked-in Rinkeby chaindata, which holds only ancient headers and bodies, and is
+// the source of the embedded "block1" dataset. Tests should use the embedded datasets instead.
 var (
 	ChainDataPath, AncientDataPath string
 )
@@ -20,8 +17,4 @@ func init() {
 
 	ChainDataPath = filepath.Join(wd, "..", "fixture", "chaindata")
 	AncientDataPath = filepath.Join(ChainDataPath, "ancient")
-
-	if _, err := os.Stat(ChainDataPath); err != nil {
-		panic("must populate chaindata at " + ChainDataPath)
-	}
 }
@@ -0,0 +1,76 @@
+package fixture
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"embed"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Datasets are LevelDB databases shipped as gzipped tarballs, which are extracted on demand:
+//
+//	block1: the Rinkeby headers at heights 0-2 with their state, which is the genesis allocation
+//
+// They are built by ./internal/gendata. The archives are not byte-stable, so they are left out of
+// go generate and only rebuilt when a dataset changes.
+//
+//go:embed data/*.tar.gz
+var datasets embed.FS
+
+// Datasets returns the names of the embedded datasets
+func Datasets() []string {
+	entries, _ := datasets.ReadDir("data")
+	var names []string
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".tar.gz"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Extract extracts a dataset into a new directory within dir, and returns its path
+func Extract(name, dir string) (string, error) {
+	f, err := datasets.Open("data/" + name + ".tar.gz")
+	if err != nil {
+		return "", fmt.Errorf("unknown dataset %q", name)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return "", err
+	}
+	dbPath := filepath.Join(dir, name)
+	if err := os.MkdirAll(dbPath, 0755); err != nil {
+		return "", err
+	}
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		out, err := os.Create(filepath.Join(dbPath, filepath.Base(hdr.Name)))
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(out, tr)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return dbPath, nil
+}
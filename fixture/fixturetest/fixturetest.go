@@ -0,0 +1,33 @@
+// Package fixturetest provides test helpers for the fixture datasets, kept apart from the fixture
+// package so that it does not depend on the testing package.
+package fixturetest
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+
+	"github.com/vulcanize/go-eth-state-node-iterator/fixture"
+)
+
+// Path extracts a dataset to a temporary directory removed when the test ends, and returns its path
+func Path(tb testing.TB, name string) string {
+	tb.Helper()
+	path, err := fixture.Extract(name, tb.TempDir())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return path
+}
+
+// Open extracts a dataset to a temporary directory and opens it, closing it when the test ends
+func Open(tb testing.TB, name string) ethdb.Database {
+	tb.Helper()
+	db, err := rawdb.NewLevelDBDatabase(Path(tb, name), 16, 16, "", false)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { db.Close() })
+	return db
+}
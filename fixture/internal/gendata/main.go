@@ -0,0 +1,160 @@
+// Command gendata builds the embedded fixture datasets.
+//
+// The "block1" dataset holds the Rinkeby headers of the fixture chaindata, with the state they
+// commit to. Rinkeby is a clique chain with no block rewards, and its first blocks are empty, so
+// the state at these heights is exactly the genesis allocation; it is rebuilt from go-ethereum's
+// Rinkeby genesis, and checked against the header roots. The node paths of the state are written
+// to paths.go as Block1_Paths.
+//
+// The archive is not byte-stable: LevelDB's log and table files differ between runs even for the
+// same contents, so regenerating it produces a spurious diff. Only regenerate it when a dataset
+// actually changes; paths.go is reproducible, and checked against the dataset by the tests.
+//
+// Usage (from the fixture directory): go run ./internal/gendata
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+
+	"github.com/vulcanize/go-eth-state-node-iterator/fixture/synth"
+)
+
+const block1Heights = 3
+
+func main() {
+	if err := genBlock1(filepath.Join("data", "block1.tar.gz"), "paths.go"); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func genBlock1(out, pathsOut string) error {
+	src, err := rawdb.NewLevelDBDatabaseWithFreezer(
+		filepath.Join("chaindata"), 16, 16, filepath.Join("chaindata", "ancient"), "", false)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	var headers []*types.Header
+	for n := uint64(0); n < block1Heights; n++ {
+		hash := rawdb.ReadCanonicalHash(src, n)
+		header := rawdb.ReadHeader(src, hash, n)
+		if header == nil {
+			return fmt.Errorf("missing header %d", n)
+		}
+		headers = append(headers, header)
+	}
+
+	dir, err := os.MkdirTemp("", "gendata")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	db, err := rawdb.NewLevelDBDatabase(dir, 16, 16, "", false)
+	if err != nil {
+		return err
+	}
+	genesis := core.DefaultRinkebyGenesisBlock().ToBlock(db)
+	for _, header := range headers {
+		if header.Root != genesis.Root() {
+			db.Close()
+			return fmt.Errorf("state root of header %d is %x, not genesis root %x", header.Number, header.Root, genesis.Root())
+		}
+		rawdb.WriteHeader(db, header)
+		rawdb.WriteCanonicalHash(db, header.Hash(), header.Number.Uint64())
+	}
+	head := headers[len(headers)-1].Hash()
+	rawdb.WriteHeadHeaderHash(db, head)
+	rawdb.WriteHeadBlockHash(db, head)
+	if err := writePaths(pathsOut, db, genesis.Root()); err != nil {
+		db.Close()
+		return err
+	}
+	if err := db.Close(); err != nil {
+		return err
+	}
+	return writeArchive(out, dir)
+}
+
+// writes the node paths of a state trie as the fixture path list
+func writePaths(out string, db ethdb.Database, root common.Hash) error {
+	tree, err := state.NewDatabase(db).OpenTrie(root)
+	if err != nil {
+		return err
+	}
+	var paths [][]byte
+	it := tree.NodeIterator(nil)
+	for it.Next(true) {
+		paths = append(paths, append([]byte{}, it.Path()...))
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := synth.WritePaths(f, "fixture", "Block1_Paths", paths); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// writes the database files of a directory to a gzipped tarball
+func writeArchive(out, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || name == "LOCK" || strings.HasPrefix(name, "LOG") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw, err := gzip.NewWriterLevel(f, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(zw)
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
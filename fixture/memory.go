@@ -0,0 +1,43 @@
+package fixture
+
+import (
+	"os"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+)
+
+// MemoryState copies the "block1" dataset state at a height into an in-memory database, along
+// with its header and canonical hash, so it can be used without an on-disk LevelDB.
+func MemoryState(height uint64) (ethdb.Database, state.Trie, *types.Header, error) {
+	dir, err := os.MkdirTemp("", "fixture")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer os.RemoveAll(dir)
+	path, err := Extract("block1", dir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	edb, err := rawdb.NewLevelDBDatabase(path, 16, 16, "", true)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer edb.Close()
+	tree, header, err := iter.OpenStateAtDB(edb, iter.BlockAt(height))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	db, copied, err := iter.CopyStateToMemory(tree, 16)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	rawdb.WriteHeader(db, header)
+	rawdb.WriteCanonicalHash(db, header.Hash(), height)
+	return db, copied, header, nil
+}
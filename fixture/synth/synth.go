@@ -0,0 +1,400 @@
+// Package synth generates deterministic synthetic state for tests and benchmarks.
+//
+// Keys are generated directly in hashed form, so the shape of the tries can be controlled; the
+// tries are written with the plain trie package and opened as state tries. The same Config always
+// produces the same state, along with the expected node paths of each trie in iteration order.
+// GenerateChain extends a state over a sequence of blocks, writing their headers so each height
+// can be opened like real chain data. WritePaths renders path lists as fixture source.
+package synth
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Shape is the distribution of keys within a trie
+type Shape int
+
+const (
+	// Uniformly random keys, giving a balanced trie of branches
+	Random Shape = iota
+	// Keys clustered under long shared prefixes, giving many extension nodes
+	ExtensionHeavy
+	// Keys diverging from a common key at every depth, giving a narrow trie as deep as the keys
+	Deep
+)
+
+func (s Shape) String() string {
+	switch s {
+	case Random:
+		return "random"
+	case ExtensionHeavy:
+		return "extension-heavy"
+	case Deep:
+		return "deep"
+	}
+	return fmt.Sprintf("Shape(%d)", int(s))
+}
+
+// Config describes the state to generate
+type Config struct {
+	Seed     int64
+	Accounts int
+	Shape    Shape
+	// The first StorageAccounts accounts are given Slots storage slots each
+	StorageAccounts int
+	Slots           int
+	StorageShape    Shape
+}
+
+// Trie is a generated trie with its expected contents
+type Trie struct {
+	Root common.Hash
+	// Hex paths of every node, in iteration order
+	Paths [][]byte
+	// Leaf keys, in order
+	Keys [][]byte
+}
+
+// State is a generated state
+type State struct {
+	DB       ethdb.Database
+	StateDB  state.Database
+	Accounts Trie
+	// Storage tries by account key
+	Storage map[common.Hash]*Trie
+}
+
+// Generate builds the state described by a config in a new in-memory database
+func Generate(cfg Config) (*State, error) {
+	db := rawdb.NewMemoryDatabase()
+	return generate(db, trie.NewDatabase(db), state.NewDatabase(db), rand.New(rand.NewSource(cfg.Seed)), cfg)
+}
+
+func generate(db ethdb.Database, triedb *trie.Database, sdb state.Database, rng *rand.Rand, cfg Config) (*State, error) {
+	keys := makeKeys(rng, cfg.Accounts, cfg.Shape)
+	storage := make(map[common.Hash]*Trie)
+	accounts := make([][]byte, len(keys))
+	for i, key := range keys {
+		account := types.StateAccount{
+			Nonce:    uint64(i),
+			Balance:  big.NewInt(rng.Int63()),
+			Root:     types.EmptyRootHash,
+			CodeHash: crypto.Keccak256(nil),
+		}
+		if i < cfg.StorageAccounts && cfg.Slots > 0 {
+			owner := common.BytesToHash(key)
+			slots := makeKeys(rng, cfg.Slots, cfg.StorageShape)
+			values := make([][]byte, len(slots))
+			for s := range slots {
+				value := make([]byte, 1+rng.Intn(32))
+				rng.Read(value)
+				value[0] |= 1 // values are trimmed of leading zeros
+				var err error
+				if values[s], err = rlp.EncodeToBytes(value); err != nil {
+					return nil, err
+				}
+			}
+			root, err := commitTrie(triedb, owner, slots, values)
+			if err != nil {
+				return nil, err
+			}
+			account.Root = root
+			storage[owner] = &Trie{Root: root, Keys: slots}
+		}
+		var err error
+		if accounts[i], err = rlp.EncodeToBytes(&account); err != nil {
+			return nil, err
+		}
+	}
+	root, err := commitTrie(triedb, common.Hash{}, keys, accounts)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &State{
+		DB:       db,
+		StateDB:  sdb,
+		Accounts: Trie{Root: root, Keys: keys},
+		Storage:  storage,
+	}
+	if err := res.collectPaths(); err != nil {
+		return nil, err
+	}
+	for owner, st := range storage {
+		tree, err := sdb.OpenStorageTrie(owner, st.Root)
+		if err != nil {
+			return nil, err
+		}
+		if st.Paths, err = collectPaths(tree); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// ChainConfig describes a chain of generated states
+type ChainConfig struct {
+	// The state at block 0
+	Config
+	// Number of blocks, including block 0
+	Blocks int
+	// Each block after block 0 updates this many existing accounts, and inserts as many new ones.
+	// Storage is not changed.
+	Updates int
+}
+
+// Chain is a generated chain of headers, with the state of each block
+type Chain struct {
+	DB      ethdb.Database
+	StateDB state.Database
+	Headers []*types.Header
+	// States by block number, sharing the chain's database and storage tries
+	States []*State
+}
+
+// GenerateChain builds the chain described by a config in a new in-memory database, with its
+// headers written as the canonical chain
+func GenerateChain(cfg ChainConfig) (*Chain, error) {
+	db := rawdb.NewMemoryDatabase()
+	triedb := trie.NewDatabase(db)
+	chain := &Chain{DB: db, StateDB: state.NewDatabase(db)}
+	rng := rand.New(rand.NewSource(cfg.Seed))
+
+	for n := 0; n < cfg.Blocks; n++ {
+		var (
+			st  *State
+			err error
+		)
+		if n == 0 {
+			st, err = generate(db, triedb, chain.StateDB, rng, cfg.Config)
+		} else {
+			st, err = nextState(triedb, rng, chain.States[n-1], cfg.Updates)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", n, err)
+		}
+		header := &types.Header{Number: big.NewInt(int64(n)), Difficulty: common.Big0, Root: st.Accounts.Root}
+		if n > 0 {
+			header.ParentHash = chain.Headers[n-1].Hash()
+		}
+		rawdb.WriteHeader(db, header)
+		rawdb.WriteCanonicalHash(db, header.Hash(), uint64(n))
+		chain.Headers = append(chain.Headers, header)
+		chain.States = append(chain.States, st)
+	}
+	if len(chain.Headers) > 0 {
+		head := chain.Headers[len(chain.Headers)-1].Hash()
+		rawdb.WriteHeadHeaderHash(db, head)
+		rawdb.WriteHeadBlockHash(db, head)
+	}
+	return chain, nil
+}
+
+// derives a state from its parent by updating and inserting accounts
+func nextState(triedb *trie.Database, rng *rand.Rand, parent *State, updates int) (*State, error) {
+	tree, err := trie.New(common.Hash{}, parent.Accounts.Root, triedb)
+	if err != nil {
+		return nil, err
+	}
+	keys := parent.Accounts.Keys
+	for i := 0; i < updates && len(keys) > 0; i++ {
+		key := keys[rng.Intn(len(keys))]
+		enc, err := tree.TryGet(key)
+		if err != nil {
+			return nil, err
+		}
+		var account types.StateAccount
+		if err := rlp.DecodeBytes(enc, &account); err != nil {
+			return nil, err
+		}
+		account.Nonce++
+		account.Balance = big.NewInt(rng.Int63())
+		if enc, err = rlp.EncodeToBytes(&account); err != nil {
+			return nil, err
+		}
+		if err := tree.TryUpdate(key, enc); err != nil {
+			return nil, err
+		}
+	}
+
+	existing := make(map[common.Hash]struct{}, len(keys))
+	for _, key := range keys {
+		existing[common.BytesToHash(key)] = struct{}{}
+	}
+	keys = append([][]byte{}, keys...)
+	for _, key := range makeKeys(rng, updates, Random) {
+		if _, has := existing[common.BytesToHash(key)]; has {
+			continue
+		}
+		account := types.StateAccount{
+			Balance:  big.NewInt(rng.Int63()),
+			Root:     types.EmptyRootHash,
+			CodeHash: crypto.Keccak256(nil),
+		}
+		enc, err := rlp.EncodeToBytes(&account)
+		if err != nil {
+			return nil, err
+		}
+		if err := tree.TryUpdate(key, enc); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+
+	root, err := commit(triedb, tree)
+	if err != nil {
+		return nil, err
+	}
+	res := &State{
+		DB:       parent.DB,
+		StateDB:  parent.StateDB,
+		Accounts: Trie{Root: root, Keys: keys},
+		Storage:  parent.Storage,
+	}
+	return res, res.collectPaths()
+}
+
+// OpenTrie opens the generated account trie
+func (s *State) OpenTrie() (state.Trie, error) {
+	return s.StateDB.OpenTrie(s.Accounts.Root)
+}
+
+func (s *State) collectPaths() error {
+	tree, err := s.OpenTrie()
+	if err != nil {
+		return err
+	}
+	s.Accounts.Paths, err = collectPaths(tree)
+	return err
+}
+
+// writes keys and values to a new trie, committing it to disk
+func commitTrie(triedb *trie.Database, owner common.Hash, keys, values [][]byte) (common.Hash, error) {
+	tree, err := trie.New(owner, common.Hash{}, triedb)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	for i, key := range keys {
+		if err := tree.TryUpdate(key, values[i]); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	return commit(triedb, tree)
+}
+
+// commits a trie's changes to disk
+func commit(triedb *trie.Database, tree *trie.Trie) (common.Hash, error) {
+	root, _, err := tree.Commit(nil)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return root, triedb.Commit(root, false, nil)
+}
+
+func collectPaths(tree state.Trie) ([][]byte, error) {
+	var paths [][]byte
+	it := tree.NodeIterator(nil)
+	for it.Next(true) {
+		paths = append(paths, append([]byte{}, it.Path()...))
+	}
+	return paths, it.Error()
+}
+
+// makeKeys generates n distinct sorted 32-byte keys of a shape
+func makeKeys(rng *rand.Rand, n int, shape Shape) [][]byte {
+	seen := make(map[common.Hash]struct{}, n)
+	var keys [][]byte
+	add := func(key []byte) {
+		hash := common.BytesToHash(key)
+		if _, has := seen[hash]; has || len(keys) == n {
+			return
+		}
+		seen[hash] = struct{}{}
+		keys = append(keys, hash.Bytes())
+	}
+	randomKey := func() []byte {
+		key := make([]byte, common.HashLength)
+		rng.Read(key)
+		return key
+	}
+
+	switch shape {
+	case ExtensionHeavy:
+		// two levels of clusters, each sharing a prefix of several bytes
+		const clusterSize, prefixLen = 8, 6
+		for len(keys) < n {
+			cluster := randomKey()
+			for sub := 0; sub < clusterSize && len(keys) < n; sub++ {
+				subcluster := randomKey()
+				copy(subcluster, cluster[:prefixLen])
+				for i := 0; i < clusterSize; i++ {
+					key := randomKey()
+					copy(key, subcluster[:2*prefixLen])
+					add(key)
+				}
+			}
+		}
+	case Deep:
+		// a "comb" of keys, each differing from a base key at one nibble
+		for len(keys) < n {
+			base := randomKey()
+			add(base)
+			for depth := 0; depth < 2*common.HashLength && len(keys) < n; depth++ {
+				key := append([]byte{}, base...)
+				flip := byte(1 + rng.Intn(15))
+				if depth%2 == 0 {
+					key[depth/2] ^= flip << 4
+				} else {
+					key[depth/2] ^= flip
+				}
+				add(key)
+			}
+		}
+	default:
+		for len(keys) < n {
+			add(randomKey())
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	return keys
+}
+
+// WritePaths writes a path list as Go source declaring a variable, in the form of the fixture
+// path lists
+func WritePaths(w io.Writer, pkg, name string, paths [][]byte) error {
+	if _, err := fmt.Fprintf(w, "package %s\n\nvar %s = [][]byte{\n", pkg, name); err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if _, err := fmt.Fprintf(w, "\t[]byte{%s},\n", formatNibbles(path)); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+func formatNibbles(path []byte) string {
+	nibbles := make([]string, len(path))
+	for i, n := range path {
+		nibbles[i] = strconv.Itoa(int(n))
+	}
+	return strings.Join(nibbles, ", ")
+}
@@ -0,0 +1,83 @@
+package iterator_test
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// builds a committed trie of random leaves in a fresh in-memory database
+func newTestTrie(t testing.TB, nleaves int, seed int64) (state.Database, state.Trie) {
+	sdb := state.NewDatabase(rawdb.NewMemoryDatabase())
+	tree, err := sdb.OpenTrie(common.Hash{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(seed))
+	root := updateTestTrie(t, sdb, tree, rng, nleaves)
+	if tree, err = sdb.OpenTrie(root); err != nil {
+		t.Fatal(err)
+	}
+	return sdb, tree
+}
+
+// writes random leaves to a trie and commits it to disk
+func updateTestTrie(t testing.TB, sdb state.Database, tree state.Trie, rng *rand.Rand, nleaves int) common.Hash {
+	for i := 0; i < nleaves; i++ {
+		key := make([]byte, 32)
+		value := make([]byte, 1+rng.Intn(64))
+		rng.Read(key)
+		rng.Read(value)
+		if err := tree.TryUpdate(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root, _, err := tree.Commit(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sdb.TrieDB().Commit(root, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// builds a canonical chain of headers whose states each add `nleaves` random leaves to the
+// previous state; the states at heights listed in `unchanged` are the same as their parent's
+func newTestChain(t testing.TB, nblocks, nleaves int, unchanged ...uint64) (ethdb.Database, []*types.Header) {
+	db := rawdb.NewMemoryDatabase()
+	sdb := state.NewDatabase(db)
+	rng := rand.New(rand.NewSource(1))
+	var (
+		headers []*types.Header
+		root    common.Hash
+	)
+	for n := 0; n < nblocks; n++ {
+		header := &types.Header{Number: big.NewInt(int64(n)), Difficulty: common.Big0}
+		if n > 0 {
+			header.ParentHash = headers[n-1].Hash()
+		}
+		skip := false
+		for _, height := range unchanged {
+			skip = skip || height == uint64(n)
+		}
+		if !skip {
+			tree, err := sdb.OpenTrie(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			root = updateTestTrie(t, sdb, tree, rng, nleaves)
+		}
+		header.Root = root
+		rawdb.WriteHeader(db, header)
+		rawdb.WriteCanonicalHash(db, header.Hash(), header.Number.Uint64())
+		headers = append(headers, header)
+	}
+	return db, headers
+}
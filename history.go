@@ -0,0 +1,101 @@
+//
+// Copyright © 2022 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package iterator
+
+import (
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// RangeMode selects which nodes are visited at each height of a HistoricalRange
+type RangeMode int
+
+const (
+	// FullState visits the entire state trie at each height
+	FullState RangeMode = iota
+	// ChangedNodes visits only the nodes which are not present in the previous block's state.
+	// Subtries whose hash is unchanged from the previous block are skipped.
+	ChangedNodes
+)
+
+// HistoricalRange iterates the state of each canonical block within a span of heights
+type HistoricalRange struct {
+	db       ethdb.Database
+	sdb      state.Database
+	from, to uint64
+	mode     RangeMode
+	nbins    uint
+}
+
+// NewHistoricalRange creates a range over the canonical blocks [from, to]. Each block's state, or
+// its changed nodes, is cut into `nbins` bins.
+func NewHistoricalRange(db ethdb.Database, from, to uint64, mode RangeMode, nbins uint) *HistoricalRange {
+	return &HistoricalRange{
+		db:    db,
+		sdb:   state.NewDatabase(db),
+		from:  from,
+		to:    to,
+		mode:  mode,
+		nbins: nbins,
+	}
+}
+
+// Each calls back with the header and node iterators for each block in the range, in order of
+// height. Iteration stops at the first error returned by the callback.
+func (r *HistoricalRange) Each(callback func(*types.Header, []trie.NodeIterator) error) error {
+	var parent *types.Header
+	if r.mode == ChangedNodes && r.from > 0 {
+		var err error
+		if parent, err = ResolveHeader(r.db, BlockAt(r.from-1)); err != nil {
+			return err
+		}
+	}
+	for height := r.from; height <= r.to; height++ {
+		header, err := ResolveHeader(r.db, BlockAt(height))
+		if err != nil {
+			return err
+		}
+		var iters []trie.NodeIterator
+		switch {
+		case r.mode == FullState || parent == nil:
+			tree, err := r.sdb.OpenTrie(header.Root)
+			if err != nil {
+				return err
+			}
+			if iters, err = SubtrieIteratorsE(tree, r.nbins); err != nil {
+				return err
+			}
+		case parent.Root == header.Root:
+			// no state change, nothing to visit
+		default:
+			fac, err := NewChangedNodesFactory(r.sdb, parent, header, r.nbins)
+			if err != nil {
+				return err
+			}
+			for bin := uint(0); bin < uint(fac.Length()); bin++ {
+				iters = append(iters, fac.IteratorAt(bin))
+			}
+		}
+		if err := callback(header, iters); err != nil {
+			return err
+		}
+		parent = header
+	}
+	return nil
+}
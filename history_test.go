@@ -0,0 +1,97 @@
+package iterator_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/trie"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+)
+
+// collects the hashes of all standalone nodes in a trie
+func trieNodeSet(t *testing.T, sdb state.Database, root common.Hash) map[common.Hash]bool {
+	tree, err := sdb.OpenTrie(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := make(map[common.Hash]bool)
+	for it := tree.NodeIterator(nil); it.Next(true); {
+		if it.Hash() != (common.Hash{}) {
+			set[it.Hash()] = true
+		}
+	}
+	return set
+}
+
+func TestHistoricalRange(t *testing.T) {
+	db, headers := newTestChain(t, 5, 50, 3)
+	sdb := state.NewDatabase(db)
+
+	t.Run("full state", func(t *testing.T) {
+		height := uint64(1)
+		err := iter.NewHistoricalRange(db, 1, 4, iter.FullState, 8).Each(
+			func(header *types.Header, iters []trie.NodeIterator) error {
+				if header.Hash() != headers[height].Hash() {
+					t.Fatalf("wrong header at height %d", height)
+				}
+				if len(iters) != 8 {
+					t.Fatalf("wrong number of bins: %d", len(iters))
+				}
+				height++
+				return nil
+			})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if height != 5 {
+			t.Fatalf("range ended at height %d", height)
+		}
+	})
+
+	for _, nbins := range []uint{1, 16} {
+		t.Run(fmt.Sprintf("changed nodes/%d bins", nbins), func(t *testing.T) {
+			err := iter.NewHistoricalRange(db, 1, 4, iter.ChangedNodes, nbins).Each(
+				func(header *types.Header, iters []trie.NodeIterator) error {
+					n := header.Number.Uint64()
+					parent := trieNodeSet(t, sdb, headers[n-1].Root)
+					expected := make(map[common.Hash]bool)
+					for hash := range trieNodeSet(t, sdb, header.Root) {
+						if !parent[hash] {
+							expected[hash] = true
+						}
+					}
+					visited := make(map[common.Hash]bool)
+					for _, it := range iters {
+						for it.Next(true) {
+							if it.Hash() == (common.Hash{}) {
+								continue
+							}
+							if parent[it.Hash()] {
+								t.Fatalf("block %d: visited unchanged node at %v", n, it.Path())
+							}
+							visited[it.Hash()] = true
+						}
+					}
+					if len(visited) != len(expected) {
+						t.Fatalf("block %d: expected %d new nodes, visited %d", n, len(expected), len(visited))
+					}
+					return nil
+				})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	t.Run("missing header", func(t *testing.T) {
+		err := iter.NewHistoricalRange(db, 3, 9, iter.FullState, 1).Each(
+			func(*types.Header, []trie.NodeIterator) error { return nil })
+		if err == nil {
+			t.Fatal("expected error for missing header")
+		}
+	})
+}
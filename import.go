@@ -0,0 +1,76 @@
+//
+// Copyright © 2022 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package iterator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// ImportNodes writes every standalone node yielded by an iterator into a key-value store, keyed by
+// hash. Embedded nodes and leaf values are skipped, as they are stored within their parents.
+// Returns the number of nodes written.
+func ImportNodes(it trie.NodeIterator, dst ethdb.KeyValueStore) (uint64, error) {
+	var count uint64
+	batch := dst.NewBatch()
+	for it.Next(true) {
+		hash := it.Hash()
+		if hash == (common.Hash{}) {
+			continue
+		}
+		blob := it.NodeBlob()
+		if blob == nil {
+			break // NodeBlob sets the iterator error
+		}
+		rawdb.WriteTrieNode(batch, hash, blob)
+		count++
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return count, err
+			}
+			batch.Reset()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return count, err
+	}
+	return count, batch.Write()
+}
+
+// ImportSubtries copies the trie covered by a factory into a key-value store, importing each bin
+// concurrently, then verifies that the copied root resolves in the destination. Nodes shared by
+// adjacent bins are written once, so the returned count is the number of distinct nodes imported.
+func ImportSubtries(fac SubtrieIteratorFactory, dst ethdb.KeyValueStore) (uint64, error) {
+	counter := NewCountingSink()
+	if err := NewSinkRunner(&fac, NewImportSink(dst), counter).Run(context.Background()); err != nil {
+		return counter.Nodes(), err
+	}
+	return counter.Nodes(), VerifyRoot(dst, fac.tree.Hash())
+}
+
+// VerifyRoot checks that a trie root resolves from the given store
+func VerifyRoot(db ethdb.KeyValueStore, root common.Hash) error {
+	if _, err := trie.New(common.Hash{}, root, trie.NewDatabase(db)); err != nil {
+		return fmt.Errorf("imported root %x does not resolve: %w", root, err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package iterator_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+)
+
+func TestImportSubtries(t *testing.T) {
+	_, tree := newTestTrie(t, 1000, 1)
+	for _, nbins := range []uint{1, 2, 16, 32} {
+		t.Run(fmt.Sprintf("%d bins", nbins), func(t *testing.T) {
+			dst := rawdb.NewMemoryDatabase()
+			if _, err := iter.ImportSubtries(iter.NewSubtrieIteratorFactory(tree, nbins), dst); err != nil {
+				t.Fatal(err)
+			}
+			copied, err := state.NewDatabase(dst).OpenTrie(tree.Hash())
+			if err != nil {
+				t.Fatal(err)
+			}
+			// every node of the copy must resolve from the new database
+			a, b := tree.NodeIterator(nil), copied.NodeIterator(nil)
+			for a.Next(true) {
+				if !b.Next(true) {
+					t.Fatalf("copied trie ended early: %v", b.Error())
+				}
+				if iter.CompareNodes(a, b) != 0 {
+					t.Fatalf("node mismatch at path %v", a.Path())
+				}
+			}
+			if b.Next(true) {
+				t.Fatalf("copied trie has extra node at %v", b.Path())
+			}
+			if err := b.Error(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestVerifyRoot(t *testing.T) {
+	_, tree := newTestTrie(t, 10, 1)
+	if err := iter.VerifyRoot(rawdb.NewMemoryDatabase(), tree.Hash()); err == nil {
+		t.Fatal("expected error for missing root")
+	}
+}
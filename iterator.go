@@ -18,6 +18,8 @@ package iterator
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"math/bits"
 
 	"github.com/ethereum/go-ethereum/core/state"
@@ -43,11 +45,27 @@ func (it *PrefixBoundIterator) Next(descend bool) bool {
 	return cmp <= 0
 }
 
+// AtSharedBoundary reports whether the current node lies on an even-length end bound, and so will
+// be visited again by an iterator starting from that bound
+func (it *PrefixBoundIterator) AtSharedBoundary() bool {
+	return it.EndPath != nil && len(it.EndPath)%2 == 0 && bytes.Equal(it.Path(), it.EndPath)
+}
+
 // Iterator with an upper bound value (hex path prefix)
 func NewPrefixBoundIterator(it trie.NodeIterator, from []byte, to []byte) *PrefixBoundIterator {
 	return &PrefixBoundIterator{NodeIterator: it, StartPath: from, EndPath: to}
 }
 
+// ErrInvalidBinCount is returned when a bin count is not a power of 2
+var ErrInvalidBinCount = errors.New("nbins must be a power of 2")
+
+func checkBinCount(nbins uint) error {
+	if bits.OnesCount(nbins) != 1 {
+		return fmt.Errorf("%w: %d", ErrInvalidBinCount, nbins)
+	}
+	return nil
+}
+
 // generates nibble slice prefixes at uniform intervals
 type prefixGenerator struct {
 	current   []byte
@@ -116,6 +134,14 @@ func MakePaths(prefix []byte, nbins uint) [][]byte {
 	return res
 }
 
+// Like MakePaths, but returns ErrInvalidBinCount instead of panicking
+func MakePathsE(prefix []byte, nbins uint) ([][]byte, error) {
+	if err := checkBinCount(nbins); err != nil {
+		return nil, err
+	}
+	return MakePaths(prefix, nbins), nil
+}
+
 func eachPrefixRange(prefix []byte, nbins uint, callback func([]byte, []byte)) {
 	prefixes := MakePaths(prefix, nbins)
 	prefixes = append(prefixes, nil) // include tail
@@ -129,6 +155,33 @@ func eachPrefixRange(prefix []byte, nbins uint, callback func([]byte, []byte)) {
 	}
 }
 
+// PathRange is the span of paths covered by a bin. A nil Start or End leaves that side unbounded.
+// Iteration includes a node at End itself, so a node on an even-length boundary is visited by both
+// adjacent bins; odd-length starts are zero-padded, so a node on an odd-length End is only visited
+// by the bin it ends.
+type PathRange struct {
+	Start []byte
+	End   []byte
+}
+
+// Returns the path ranges of the `nbins` bins used to cut a trie (w/ opt. prefix)
+// eg. MakeRanges([], 2) => [{nil [8]} {[8 0] nil}]
+func MakeRanges(prefix []byte, nbins uint) []PathRange {
+	var res []PathRange
+	eachPrefixRange(prefix, nbins, func(from []byte, to []byte) {
+		res = append(res, PathRange{Start: from, End: to})
+	})
+	return res
+}
+
+// Like MakeRanges, but returns ErrInvalidBinCount instead of panicking
+func MakeRangesE(prefix []byte, nbins uint) ([]PathRange, error) {
+	if err := checkBinCount(nbins); err != nil {
+		return nil, err
+	}
+	return MakeRanges(prefix, nbins), nil
+}
+
 // Cut a trie by path prefix, returning `nbins` iterators covering its subtries
 func SubtrieIterators(tree state.Trie, nbins uint) []trie.NodeIterator {
 	var iters []trie.NodeIterator
@@ -139,6 +192,20 @@ func SubtrieIterators(tree state.Trie, nbins uint) []trie.NodeIterator {
 	return iters
 }
 
+// Like SubtrieIterators, but returns ErrInvalidBinCount instead of panicking
+func SubtrieIteratorsE(tree state.Trie, nbins uint) ([]trie.NodeIterator, error) {
+	if err := checkBinCount(nbins); err != nil {
+		return nil, err
+	}
+	return SubtrieIterators(tree, nbins), nil
+}
+
+// BinIteratorFactory creates the bounded iterators of a trie cut into bins
+type BinIteratorFactory interface {
+	Length() int
+	IteratorAt(bin uint) *PrefixBoundIterator
+}
+
 // Factory for per-bin subtrie iterators
 type SubtrieIteratorFactory struct {
 	tree                 state.Trie
@@ -147,8 +214,20 @@ type SubtrieIteratorFactory struct {
 
 func (fac *SubtrieIteratorFactory) Length() int { return len(fac.startPaths) }
 
+// iterating a trie updates its cached root, so give each iterator its own copy where possible,
+// letting bins run concurrently
+func copyTrie(tree state.Trie) state.Trie {
+	if c, ok := tree.(interface{ Copy() *trie.SecureTrie }); ok {
+		return c.Copy()
+	}
+	return tree
+}
+
+func (fac *SubtrieIteratorFactory) treeCopy() state.Trie { return copyTrie(fac.tree) }
+
 func (fac *SubtrieIteratorFactory) IteratorAt(bin uint) *PrefixBoundIterator {
-	it := fac.tree.NodeIterator(HexToKeyBytes(fac.startPaths[bin]))
+	start := HexToKeyBytes(fac.startPaths[bin])
+	it := fac.treeCopy().NodeIterator(start)
 	return NewPrefixBoundIterator(it, fac.startPaths[bin], fac.endPaths[bin])
 }
 
@@ -162,3 +241,11 @@ func NewSubtrieIteratorFactory(tree state.Trie, nbins uint) SubtrieIteratorFacto
 	})
 	return SubtrieIteratorFactory{tree: tree, startPaths: starts, endPaths: ends}
 }
+
+// Like NewSubtrieIteratorFactory, but returns ErrInvalidBinCount instead of panicking
+func NewSubtrieIteratorFactoryE(tree state.Trie, nbins uint) (SubtrieIteratorFactory, error) {
+	if err := checkBinCount(nbins); err != nil {
+		return SubtrieIteratorFactory{}, err
+	}
+	return NewSubtrieIteratorFactory(tree, nbins), nil
+}
@@ -2,14 +2,18 @@ package iterator_test
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"testing"
 
-	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/trie"
 
 	iter "github.com/vulcanize/go-eth-state-node-iterator"
 	fixt "github.com/vulcanize/go-eth-state-node-iterator/fixture"
+	"github.com/vulcanize/go-eth-state-node-iterator/fixture/fixturetest"
+	"github.com/vulcanize/go-eth-state-node-iterator/fixture/synth"
 )
 
 func TestMakePaths(t *testing.T) {
@@ -23,24 +27,56 @@ func TestMakePaths(t *testing.T) {
 	}
 }
 
-func TestIterator(t *testing.T) {
-	edb, err := rawdb.NewLevelDBDatabaseWithFreezer(
-		fixt.ChainDataPath, 1024, 256, fixt.AncientDataPath,
-		"eth-pg-ipfs-state-snapshot", false,
-	)
-	if err != nil {
-		t.Fatal(err)
+func TestInvalidBinCount(t *testing.T) {
+	_, tree := newTestTrie(t, 10, 1)
+	for _, nbins := range []uint{0, 3, 6, 100} {
+		if _, err := iter.MakePathsE(nil, nbins); !errors.Is(err, iter.ErrInvalidBinCount) {
+			t.Errorf("MakePathsE(%d): expected ErrInvalidBinCount, have %v", nbins, err)
+		}
+		if _, err := iter.MakeRangesE(nil, nbins); !errors.Is(err, iter.ErrInvalidBinCount) {
+			t.Errorf("MakeRangesE(%d): expected ErrInvalidBinCount, have %v", nbins, err)
+		}
+		if _, err := iter.SubtrieIteratorsE(tree, nbins); !errors.Is(err, iter.ErrInvalidBinCount) {
+			t.Errorf("SubtrieIteratorsE(%d): expected ErrInvalidBinCount, have %v", nbins, err)
+		}
+		if _, err := iter.NewSubtrieIteratorFactoryE(tree, nbins); !errors.Is(err, iter.ErrInvalidBinCount) {
+			t.Errorf("NewSubtrieIteratorFactoryE(%d): expected ErrInvalidBinCount, have %v", nbins, err)
+		}
+	}
+	fac, err := iter.NewSubtrieIteratorFactoryE(tree, 8)
+	if err != nil || fac.Length() != 8 {
+		t.Fatalf("failed to create factory: %v", err)
 	}
-	defer edb.Close()
+}
 
-	height := uint64(1)
-	hash := rawdb.ReadCanonicalHash(edb, height)
-	header := rawdb.ReadHeader(edb, hash, height)
-	if header == nil {
-		t.Fatalf("unable to read canonical header at height %d", height)
+func TestMakeRanges(t *testing.T) {
+	ranges := iter.MakeRanges(nil, 2)
+	expected := []iter.PathRange{{nil, []byte{8}}, {[]byte{8, 0}, nil}}
+	if len(ranges) != len(expected) {
+		t.Fatalf("wrong number of ranges; expected %d, have %d", len(expected), len(ranges))
 	}
-	sdb := state.NewDatabase(edb)
-	tree, err := sdb.OpenTrie(header.Root)
+	for i := range expected {
+		if !bytes.Equal(ranges[i].Start, expected[i].Start) || !bytes.Equal(ranges[i].End, expected[i].End) ||
+			(ranges[i].Start == nil) != (expected[i].Start == nil) || (ranges[i].End == nil) != (expected[i].End == nil) {
+			t.Errorf("wrong range %d; expected %v, have %v", i, expected[i], ranges[i])
+		}
+	}
+	for i := 0; i < 8; i++ {
+		nbins := uint(1) << i
+		ranges := iter.MakeRanges(nil, nbins)
+		if len(ranges) != int(nbins) {
+			t.Fatalf("wrong number of ranges; expected %d, have %d", nbins, len(ranges))
+		}
+		for b := 1; b < len(ranges); b++ {
+			if bytes.Compare(ranges[b-1].End, ranges[b].Start) > 0 {
+				t.Fatalf("ranges out of order at bin %d: %v", b, ranges)
+			}
+		}
+	}
+}
+
+func TestIterator(t *testing.T) {
+	tree, _, err := iter.OpenStateAtDB(fixturetest.Open(t, "block1"), iter.BlockAt(1))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -98,3 +134,95 @@ func TestIterator(t *testing.T) {
 		}
 	})
 }
+
+// checks that the bins of a factory visit exactly the given paths, with only nodes on a shared
+// boundary repeated
+func checkCoverage(t *testing.T, tree state.Trie, nbins uint, allPaths [][]byte) {
+	fac := iter.NewSubtrieIteratorFactory(tree, nbins)
+	var iters []trie.NodeIterator
+	for b := uint(0); b < nbins; b++ {
+		iters = append(iters, fac.IteratorAt(b))
+	}
+	checkRangeCoverage(t, iters, iter.MakeRanges(nil, nbins), allPaths)
+}
+
+// checks that iterators over consecutive ranges visit exactly the given paths, in order, with only
+// nodes on a shared boundary repeated
+func checkRangeCoverage(t testing.TB, iters []trie.NodeIterator, ranges []iter.PathRange, allPaths [][]byte) {
+	t.Helper()
+	ix := 0
+	for b, it := range iters {
+		var last []byte
+		for ; it.Next(true); ix++ {
+			if ix >= len(allPaths) {
+				t.Fatalf("extra path in bin %d: %v", b, it.Path())
+			}
+			if !bytes.Equal(allPaths[ix], it.Path()) {
+				t.Fatalf("wrong path value in bin %d\nexpected:\t%v\nactual:\t\t%v", b, allPaths[ix], it.Path())
+			}
+			if last != nil && bytes.Compare(last, it.Path()) >= 0 {
+				t.Fatalf("paths out of order in bin %d: %v follows %v", b, it.Path(), last)
+			}
+			last = append(last[:0], it.Path()...)
+		}
+		if err := it.Error(); err != nil {
+			t.Fatal(err)
+		}
+		// a node on an even-length end bound is visited again by the next bin
+		end := ranges[b].End
+		if ix > 0 && len(end)%2 == 0 && bytes.Equal(allPaths[ix-1], end) && b+1 < len(iters) {
+			ix--
+		}
+	}
+	if ix != len(allPaths) {
+		t.Fatalf("wrong node count; expected %d, have %d", len(allPaths), ix)
+	}
+}
+
+func TestIteratorShapes(t *testing.T) {
+	for _, shape := range []synth.Shape{synth.Random, synth.ExtensionHeavy, synth.Deep} {
+		st, err := synth.Generate(synth.Config{
+			Seed: 1, Accounts: 2000, Shape: shape,
+			StorageAccounts: 1, Slots: 500, StorageShape: shape,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree, err := st.OpenTrie()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var extensions, depth int
+		for it := tree.NodeIterator(nil); it.Next(true); {
+			if it.Hash() == (common.Hash{}) {
+				continue
+			}
+			if typ, _, _ := iter.ResolveNodeType(it.NodeBlob()); typ == iter.ExtensionNode {
+				extensions++
+			}
+			if len(it.Path()) > depth {
+				depth = len(it.Path())
+			}
+		}
+		if shape == synth.ExtensionHeavy && extensions < 100 {
+			t.Errorf("too few extension nodes for %v trie: %d", shape, extensions)
+		}
+		if shape == synth.Deep && depth < 32 {
+			t.Errorf("too shallow %v trie: depth %d", shape, depth)
+		}
+		for _, nbins := range []uint{1, 2, 16, 32, 256, 4096} {
+			t.Run(fmt.Sprintf("%v/%d bins", shape, nbins), func(t *testing.T) {
+				checkCoverage(t, tree, nbins, st.Accounts.Paths)
+			})
+		}
+		for owner, storage := range st.Storage {
+			tree, err := st.StateDB.OpenStorageTrie(owner, storage.Root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Run(fmt.Sprintf("%v/storage", shape), func(t *testing.T) {
+				checkCoverage(t, tree, 64, storage.Paths)
+			})
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package iterator
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// NodeType is the kind of an encoded trie node
+type NodeType int
+
+// Values match the node_type column of ipld-eth-db
+const (
+	BranchNode NodeType = iota
+	ExtensionNode
+	LeafNode
+)
+
+func (t NodeType) String() string {
+	switch t {
+	case BranchNode:
+		return "branch"
+	case ExtensionNode:
+		return "extension"
+	case LeafNode:
+		return "leaf"
+	}
+	return fmt.Sprintf("NodeType(%d)", int(t))
+}
+
+// ResolveNodeType decodes the type of an RLP-encoded trie node. For short nodes the hex-encoded
+// key fragment is also returned, including the terminator for leaves.
+func ResolveNodeType(blob []byte) (NodeType, []byte, error) {
+	elems, _, err := rlp.SplitList(blob)
+	if err != nil {
+		return 0, nil, err
+	}
+	count, err := rlp.CountValues(elems)
+	if err != nil {
+		return 0, nil, err
+	}
+	switch count {
+	case 17:
+		return BranchNode, nil, nil
+	case 2:
+		compact, _, err := rlp.SplitString(elems)
+		if err != nil {
+			return 0, nil, err
+		}
+		hex, err := CompactToHex(compact)
+		if err != nil {
+			return 0, nil, err
+		}
+		if hasTerm(hex) {
+			return LeafNode, hex, nil
+		}
+		return ExtensionNode, hex, nil
+	}
+	return 0, nil, fmt.Errorf("invalid number of list elements: %d", count)
+}
+
+// childHashes returns the paths and hashes of the children referenced by an RLP-encoded trie node
+// at path, in path order. Children embedded in the node are skipped, and leaves have none.
+func childHashes(path, blob []byte) ([][]byte, []common.Hash, error) {
+	typ, key, err := ResolveNodeType(blob)
+	if err != nil || typ == LeafNode {
+		return nil, nil, err
+	}
+	elems, _, err := rlp.SplitList(blob)
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		paths  [][]byte
+		hashes []common.Hash
+	)
+	for i := 0; len(elems) > 0; i++ {
+		kind, content, rest, err := rlp.Split(elems)
+		if err != nil {
+			return nil, nil, err
+		}
+		elems = rest
+		if kind != rlp.String || len(content) != common.HashLength {
+			continue
+		}
+		var child []byte
+		switch {
+		case typ == ExtensionNode && i == 1:
+			child = append(append([]byte{}, path...), key...)
+		case typ == BranchNode && i < 16:
+			child = append(append([]byte{}, path...), byte(i))
+		default:
+			continue // a short node's key, or a branch value
+		}
+		paths = append(paths, child)
+		hashes = append(hashes, common.BytesToHash(content))
+	}
+	return paths, hashes, nil
+}
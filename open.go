@@ -0,0 +1,171 @@
+//
+// Copyright © 2022 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package iterator
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+var (
+	// ErrHeaderNotFound is returned when a selected block's header is not in the database
+	ErrHeaderNotFound = errors.New("header not found")
+	// ErrStateNotFound is returned when a header's state root is not in the database
+	ErrStateNotFound = errors.New("state root not found")
+)
+
+// Database parameters used when opening chaindata
+const (
+	dbCache     = 1024
+	dbHandles   = 256
+	dbNamespace = "eth-state-node-iterator"
+)
+
+type selectorKind int
+
+const (
+	selectNumber selectorKind = iota
+	selectHash
+	selectHead
+	selectFinalized
+)
+
+// BlockSelector identifies a block by height, hash, or as the current head or finalized block
+type BlockSelector struct {
+	kind   selectorKind
+	number uint64
+	hash   common.Hash
+}
+
+var (
+	// HeadBlock selects the head header of the canonical chain
+	HeadBlock = BlockSelector{kind: selectHead}
+	// FinalizedBlock selects the most recent finalized block
+	FinalizedBlock = BlockSelector{kind: selectFinalized}
+)
+
+// BlockAt selects the canonical block at a height
+func BlockAt(number uint64) BlockSelector {
+	return BlockSelector{kind: selectNumber, number: number}
+}
+
+// BlockWithHash selects a block by hash
+func BlockWithHash(hash common.Hash) BlockSelector {
+	return BlockSelector{kind: selectHash, hash: hash}
+}
+
+// ParseBlockSelector parses a height, a 0x-prefixed hash, "head" or "finalized"
+func ParseBlockSelector(s string) (BlockSelector, error) {
+	switch s = strings.TrimSpace(s); {
+	case s == "head" || s == "latest":
+		return HeadBlock, nil
+	case s == "finalized":
+		return FinalizedBlock, nil
+	case strings.HasPrefix(s, "0x"):
+		b, err := hexutil.Decode(s)
+		if err != nil || len(b) != common.HashLength {
+			return BlockSelector{}, fmt.Errorf("invalid block hash: %s", s)
+		}
+		return BlockWithHash(common.BytesToHash(b)), nil
+	}
+	number, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return BlockSelector{}, fmt.Errorf("invalid block selector: %s", s)
+	}
+	return BlockAt(number), nil
+}
+
+func (sel BlockSelector) String() string {
+	switch sel.kind {
+	case selectHash:
+		return sel.hash.Hex()
+	case selectHead:
+		return "head"
+	case selectFinalized:
+		return "finalized"
+	}
+	return strconv.FormatUint(sel.number, 10)
+}
+
+// ResolveHeader reads the header of a selected block
+func ResolveHeader(db ethdb.Reader, sel BlockSelector) (*types.Header, error) {
+	var (
+		hash   common.Hash
+		number *uint64
+	)
+	switch sel.kind {
+	case selectNumber:
+		hash, number = rawdb.ReadCanonicalHash(db, sel.number), &sel.number
+	case selectHash:
+		hash = sel.hash
+	case selectHead:
+		hash = rawdb.ReadHeadHeaderHash(db)
+	case selectFinalized:
+		hash = rawdb.ReadFinalizedBlockHash(db)
+	}
+	if hash == (common.Hash{}) {
+		return nil, fmt.Errorf("%w: no hash for block %s", ErrHeaderNotFound, sel)
+	}
+	if number == nil {
+		number = rawdb.ReadHeaderNumber(db, hash)
+	}
+	if number == nil {
+		return nil, fmt.Errorf("%w: no number for block %s", ErrHeaderNotFound, sel)
+	}
+	header := rawdb.ReadHeader(db, hash, *number)
+	if header == nil {
+		return nil, fmt.Errorf("%w: block %s", ErrHeaderNotFound, sel)
+	}
+	return header, nil
+}
+
+// OpenStateAtDB opens the state trie of a selected block from an open database
+func OpenStateAtDB(db ethdb.Database, sel BlockSelector) (state.Trie, *types.Header, error) {
+	header, err := ResolveHeader(db, sel)
+	if err != nil {
+		return nil, nil, err
+	}
+	tree, err := state.NewDatabase(db).OpenTrie(header.Root)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: root %x of block %d: %v", ErrStateNotFound, header.Root, header.Number, err)
+	}
+	return tree, header, nil
+}
+
+// OpenStateAt opens a LevelDB chaindata directory and its freezer, and returns the state trie of a
+// selected block along with its header. The returned database must be closed by the caller.
+func OpenStateAt(dbPath, ancientPath string, sel BlockSelector) (state.Trie, *types.Header, ethdb.Database, error) {
+	db, err := rawdb.NewLevelDBDatabaseWithFreezer(dbPath, dbCache, dbHandles, ancientPath, dbNamespace, false)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	tree, header, err := OpenStateAtDB(db, sel)
+	if err != nil {
+		db.Close()
+		return nil, nil, nil, err
+	}
+	return tree, header, db, nil
+}
@@ -0,0 +1,165 @@
+package iterator_test
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+	fixt "github.com/vulcanize/go-eth-state-node-iterator/fixture"
+	"github.com/vulcanize/go-eth-state-node-iterator/fixture/fixturetest"
+	"github.com/vulcanize/go-eth-state-node-iterator/fixture/synth"
+)
+
+func TestParseBlockSelector(t *testing.T) {
+	hash := "0x" + common.Bytes2Hex(common.HexToHash("0xabcd").Bytes())
+	for _, s := range []string{"head", "latest", "finalized", "0", "1234", hash} {
+		sel, err := iter.ParseBlockSelector(s)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", s, err)
+		}
+		if s != "latest" && sel.String() != s {
+			t.Errorf("wrong selector string; expected %s, have %s", s, sel)
+		}
+	}
+	invalidHash := "0x" + strings.Repeat("zz", common.HashLength)
+	for _, s := range []string{"", "-1", "0xabcd", "earliest", invalidHash} {
+		if _, err := iter.ParseBlockSelector(s); err == nil {
+			t.Errorf("expected error parsing %q", s)
+		}
+	}
+}
+
+func TestOpenStateAtDB(t *testing.T) {
+	db, headers := newTestChain(t, 4, 20)
+	rawdb.WriteHeadHeaderHash(db, headers[3].Hash())
+	rawdb.WriteFinalizedBlockHash(db, headers[2].Hash())
+
+	cases := map[string]struct {
+		sel    iter.BlockSelector
+		header *types.Header
+	}{
+		"height":    {iter.BlockAt(1), headers[1]},
+		"hash":      {iter.BlockWithHash(headers[2].Hash()), headers[2]},
+		"head":      {iter.HeadBlock, headers[3]},
+		"finalized": {iter.FinalizedBlock, headers[2]},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			tree, header, err := iter.OpenStateAtDB(db, tc.sel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if header.Hash() != tc.header.Hash() {
+				t.Fatalf("wrong header; expected %d, have %d", tc.header.Number, header.Number)
+			}
+			if tree.Hash() != tc.header.Root {
+				t.Fatalf("wrong state root")
+			}
+		})
+	}
+
+	t.Run("missing header", func(t *testing.T) {
+		_, _, err := iter.OpenStateAtDB(db, iter.BlockAt(10))
+		if !errors.Is(err, iter.ErrHeaderNotFound) {
+			t.Fatalf("expected ErrHeaderNotFound, have %v", err)
+		}
+		_, _, err = iter.OpenStateAtDB(rawdb.NewMemoryDatabase(), iter.FinalizedBlock)
+		if !errors.Is(err, iter.ErrHeaderNotFound) {
+			t.Fatalf("expected ErrHeaderNotFound, have %v", err)
+		}
+	})
+
+	t.Run("missing root", func(t *testing.T) {
+		header := &types.Header{Number: big.NewInt(4), Root: common.HexToHash("0x01"), Difficulty: common.Big0}
+		rawdb.WriteHeader(db, header)
+		rawdb.WriteCanonicalHash(db, header.Hash(), 4)
+		_, _, err := iter.OpenStateAtDB(db, iter.BlockAt(4))
+		if !errors.Is(err, iter.ErrStateNotFound) {
+			t.Fatalf("expected ErrStateNotFound, have %v", err)
+		}
+	})
+}
+
+func TestOpenDataset(t *testing.T) {
+	path := fixturetest.Path(t, "block1")
+	tree, header, db, err := iter.OpenStateAt(path, filepath.Join(path, "ancient"), iter.HeadBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if header.Number.Uint64() != 2 {
+		t.Fatalf("wrong head block; expected 2, have %d", header.Number)
+	}
+	var paths [][]byte
+	for it := tree.NodeIterator(nil); it.Next(true); {
+		paths = append(paths, append([]byte{}, it.Path()...))
+	}
+	if len(paths) != len(fixt.Block1_Paths) {
+		t.Fatalf("wrong node count; expected %d, have %d", len(fixt.Block1_Paths), len(paths))
+	}
+	// the embedded path list is exactly what the generator writes for the dataset
+	var src bytes.Buffer
+	if err := synth.WritePaths(&src, "fixture", "Block1_Paths", paths); err != nil {
+		t.Fatal(err)
+	}
+	golden, err := os.ReadFile(filepath.Join("fixture", "paths.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src.Bytes(), golden) {
+		t.Fatal("fixture/paths.go differs from the paths written for the dataset")
+	}
+
+	_, copied, header, err := fixt.MemoryState(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied.Hash() != header.Root {
+		t.Fatal("wrong root for in-memory state")
+	}
+	if _, err := fixt.Extract("nonexistent", t.TempDir()); err == nil {
+		t.Fatal("expected error for unknown dataset")
+	}
+}
+
+func TestOpenGeneratedChain(t *testing.T) {
+	chain, err := synth.GenerateChain(synth.ChainConfig{
+		Config: synth.Config{Seed: 1, Accounts: 500, StorageAccounts: 2, Slots: 50},
+		Blocks: 4, Updates: 20,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n, st := range chain.States {
+		tree, header, err := iter.OpenStateAtDB(chain.DB, iter.BlockAt(uint64(n)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Hash() != chain.Headers[n].Hash() || tree.Hash() != st.Accounts.Root {
+			t.Fatalf("block %d: wrong header or state", n)
+		}
+		if n > 0 && st.Accounts.Root == chain.States[n-1].Accounts.Root {
+			t.Fatalf("block %d: state unchanged", n)
+		}
+		if expected := 500 + 20*n; len(st.Accounts.Keys) != expected {
+			t.Fatalf("block %d: expected %d accounts, have %d", n, expected, len(st.Accounts.Keys))
+		}
+		checkCoverage(t, tree, 16, st.Accounts.Paths)
+	}
+	_, header, err := iter.OpenStateAtDB(chain.DB, iter.HeadBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Number.Uint64() != 3 {
+		t.Fatalf("wrong head block; expected 3, have %d", header.Number)
+	}
+}
@@ -0,0 +1,207 @@
+package iterator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Path is a hex-encoded trie path: one nibble per byte, with an optional trailing terminator
+type Path []byte
+
+const hexDigits = "0123456789abcdef"
+
+// ParsePath parses a string of hex digits, as produced by Path.String, into a path
+func ParsePath(s string) (Path, error) {
+	term := strings.HasSuffix(s, "#")
+	s = strings.TrimSuffix(s, "#")
+	path := make(Path, 0, len(s)+1)
+	for i, c := range strings.ToLower(s) {
+		n := strings.IndexRune(hexDigits, c)
+		if n < 0 {
+			return nil, fmt.Errorf("%w: %q at index %d", ErrInvalidPath, c, i)
+		}
+		path = append(path, byte(n))
+	}
+	if term {
+		path = append(path, 16)
+	}
+	return path, nil
+}
+
+// PathFromKey returns the full leaf path of a key
+func PathFromKey(key []byte) Path {
+	return KeyBytesToHex(key)
+}
+
+// String renders the path as hex digits, with a trailing '#' for the terminator
+func (p Path) String() string {
+	var sb strings.Builder
+	sb.Grow(len(p))
+	for _, n := range p {
+		switch {
+		case n < 16:
+			sb.WriteByte(hexDigits[n])
+		case n == 16:
+			sb.WriteByte('#')
+		default:
+			sb.WriteByte('?')
+		}
+	}
+	return sb.String()
+}
+
+// IsLeaf reports whether the path has a terminator
+func (p Path) IsLeaf() bool { return hasTerm(p) }
+
+// Nibbles returns the path without any terminator
+func (p Path) Nibbles() Path {
+	if hasTerm(p) {
+		return p[:len(p)-1]
+	}
+	return p
+}
+
+// KeyBytes converts the path to key bytes, failing if it has an odd number of nibbles
+func (p Path) KeyBytes() ([]byte, error) { return HexToKeyBytesE(p) }
+
+// PaddedKeyBytes converts the path to key bytes, zero-padding an odd number of nibbles
+func (p Path) PaddedKeyBytes() []byte { return HexToKeyBytesPadded(p) }
+
+// Compact returns the compact encoding of the path
+func (p Path) Compact() []byte { return HexToCompact(p) }
+
+// HasPrefix reports whether the path begins with a prefix
+func (p Path) HasPrefix(prefix Path) bool { return HasPrefix(p, prefix) }
+
+// CommonPrefix returns the longest common prefix of two paths
+func (p Path) CommonPrefix(other Path) Path { return p[:CommonPrefixLen(p, other)] }
+
+// Validate checks that the path contains only nibbles, with at most a trailing terminator
+func (p Path) Validate() error { return ValidateHexPath(p) }
+
+// Path arithmetic treats a path as a base-16 fraction of the keyspace, so that [8] is its
+// midpoint and [4 0] and [4] are the same position. Terminators are ignored.
+
+// Successor returns the path of the same length following this one, e.g. [3 f] => [4 0]. Returns
+// false if the path is all f's.
+func (p Path) Successor() (Path, bool) {
+	next := append(Path{}, p.Nibbles()...)
+	for i := len(next) - 1; i >= 0; i-- {
+		if next[i] < 0xf {
+			next[i]++
+			return next, true
+		}
+		next[i] = 0
+	}
+	return nil, false
+}
+
+// Predecessor returns the path of the same length preceding this one, e.g. [4 0] => [3 f].
+// Returns false if the path is all zeros.
+func (p Path) Predecessor() (Path, bool) {
+	prev := append(Path{}, p.Nibbles()...)
+	for i := len(prev) - 1; i >= 0; i-- {
+		if prev[i] > 0 {
+			prev[i]--
+			return prev, true
+		}
+		prev[i] = 0xf
+	}
+	return nil, false
+}
+
+// Midpoint returns the path halfway between two positions. A nil end denotes the end of the
+// keyspace. The result is one nibble longer than the longer input when needed for precision.
+func Midpoint(start, end Path) Path {
+	start, end = start.Nibbles(), end.Nibbles()
+	width := len(start)
+	if len(end) > width {
+		width = len(end)
+	}
+	// sum as digits with a leading integer digit
+	sum := make([]byte, width+1)
+	if end == nil {
+		sum[0] = 1
+	}
+	carry := byte(0)
+	for i := width; i >= 1; i-- {
+		d := carry
+		if i-1 < len(start) {
+			d += start[i-1]
+		}
+		if i-1 < len(end) {
+			d += end[i-1]
+		}
+		sum[i], carry = d%16, d/16
+	}
+	sum[0] += carry
+	// halve, most significant digit first
+	mid := make(Path, 0, width+1)
+	rem := byte(0)
+	for i, d := range sum {
+		cur := rem*16 + d
+		if i > 0 {
+			mid = append(mid, cur/2)
+		}
+		rem = cur % 2
+	}
+	if rem != 0 {
+		mid = append(mid, 8)
+	}
+	return mid
+}
+
+// ComparePositions compares the keyspace positions of two paths, so that [4] and [4 0] are equal
+func ComparePositions(a, b Path) int {
+	a, b = a.Nibbles(), b.Nibbles()
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y byte
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// SplitRange cuts a range into `nbins` conterminous ranges by repeated bisection, using the same
+// bound conventions as MakeRanges: odd-length starts are zero-padded, and a nil bound is
+// unbounded. nbins must be a power of 2.
+func SplitRange(r PathRange, nbins uint) []PathRange {
+	if err := checkBinCount(nbins); err != nil {
+		panic(err)
+	}
+	bounds := []Path{r.Start, r.End}
+	for n := uint(1); n < nbins; n <<= 1 {
+		next := make([]Path, 0, 2*len(bounds)-1)
+		for i := 0; i < len(bounds)-1; i++ {
+			next = append(next, bounds[i], Midpoint(bounds[i], bounds[i+1]))
+		}
+		bounds = append(next, bounds[len(bounds)-1])
+	}
+	res := make([]PathRange, 0, nbins)
+	for i := 0; i < len(bounds)-1; i++ {
+		start := []byte(bounds[i])
+		if i > 0 && len(start)%2 != 0 { // zero-pad for odd-length keys
+			start = append(start, 0)
+		}
+		res = append(res, PathRange{Start: start, End: bounds[i+1]})
+	}
+	return res
+}
+
+// Like SplitRange, but returns ErrInvalidBinCount instead of panicking
+func SplitRangeE(r PathRange, nbins uint) ([]PathRange, error) {
+	if err := checkBinCount(nbins); err != nil {
+		return nil, err
+	}
+	return SplitRange(r, nbins), nil
+}
@@ -0,0 +1,112 @@
+package iterator_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+)
+
+func TestPathSuccessor(t *testing.T) {
+	cases := []struct{ path, succ string }{
+		{"0", "1"}, {"3f", "40"}, {"0ff", "100"}, {"", ""}, {"ff", ""}, {"12#", "13"},
+	}
+	for _, tc := range cases {
+		path, _ := iter.ParsePath(tc.path)
+		succ, ok := path.Successor()
+		if ok != (tc.succ != "") || succ.String() != tc.succ {
+			t.Errorf("wrong successor of %q; expected %q, have %q", tc.path, tc.succ, succ)
+		}
+		if !ok {
+			continue
+		}
+		pred, ok := succ.Predecessor()
+		if !ok || pred.String() != path.Nibbles().String() {
+			t.Errorf("wrong predecessor of %q; expected %q, have %q", succ, path.Nibbles(), pred)
+		}
+	}
+	if _, ok := (iter.Path{0, 0}).Predecessor(); ok {
+		t.Error("expected no predecessor for 00")
+	}
+}
+
+func TestMidpoint(t *testing.T) {
+	cases := []struct{ start, end, mid string }{
+		{"", "<nil>", "8"},
+		{"8", "<nil>", "c"},
+		{"0", "1", "08"},
+		{"08", "1", "0c"},
+		{"0", "08", "04"},
+		{"3a", "3c", "3b"},
+		{"f", "<nil>", "f8"},
+		{"1", "1", "1"},
+	}
+	for _, tc := range cases {
+		start, _ := iter.ParsePath(tc.start)
+		var end iter.Path
+		if tc.end != "<nil>" {
+			end, _ = iter.ParsePath(tc.end)
+		}
+		if mid := iter.Midpoint(start, end); mid.String() != tc.mid {
+			t.Errorf("wrong midpoint of %q and %q; expected %q, have %q", tc.start, tc.end, tc.mid, mid)
+		}
+	}
+	if iter.ComparePositions(iter.Path{4}, iter.Path{4, 0}) != 0 ||
+		iter.ComparePositions(iter.Path{3, 15}, iter.Path{4}) != -1 {
+		t.Error("wrong position comparison")
+	}
+}
+
+func TestSplitRange(t *testing.T) {
+	for _, nbins := range []uint{1, 2, 4, 16} {
+		split := iter.SplitRange(iter.PathRange{}, nbins)
+		made := iter.MakeRanges(nil, nbins)
+		for i := range made {
+			if iter.ComparePositions(split[i].Start, made[i].Start) != 0 ||
+				iter.ComparePositions(split[i].End, made[i].End) != 0 {
+				t.Errorf("%d bins: range %d differs from MakeRanges; expected %v, have %v", nbins, i, made[i], split[i])
+			}
+		}
+	}
+
+	_, tree := newTestTrie(t, 2000, 1)
+	cases := []iter.PathRange{
+		{},
+		{Start: nil, End: []byte{5}},
+		{Start: []byte{3, 0}, End: []byte{5}},
+		{Start: []byte{7, 12}, End: []byte{7, 13, 2}},
+	}
+	for _, r := range cases {
+		var expected [][]byte
+		for it := rangeIterators(tree, []iter.PathRange{r})[0]; it.Next(true); {
+			expected = append(expected, append([]byte{}, it.Path()...))
+		}
+		for _, nbins := range []uint{2, 8, 32, 128} {
+			t.Run(fmt.Sprintf("%v/%d bins", r, nbins), func(t *testing.T) {
+				split := iter.SplitRange(r, nbins)
+				if len(split) != int(nbins) {
+					t.Fatalf("wrong number of ranges: %d", len(split))
+				}
+				checkRangeCoverage(t, rangeIterators(tree, split), split, expected)
+			})
+		}
+	}
+
+	for _, nbins := range []uint{0, 3, 12} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%d bins: expected panic", nbins)
+				}
+			}()
+			iter.SplitRange(iter.PathRange{}, nbins)
+		}()
+		if _, err := iter.SplitRangeE(iter.PathRange{}, nbins); !errors.Is(err, iter.ErrInvalidBinCount) {
+			t.Errorf("SplitRangeE(%d): expected ErrInvalidBinCount, have %v", nbins, err)
+		}
+	}
+	if split, err := iter.SplitRangeE(iter.PathRange{}, 4); err != nil || len(split) != 4 {
+		t.Fatalf("SplitRangeE failed: %v", err)
+	}
+}
@@ -0,0 +1,285 @@
+//
+// Copyright © 2022 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package iterator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// TrieRange is a range of paths within the state trie or an account's storage trie
+type TrieRange struct {
+	// Hash of the owning account; zero for the state trie
+	Owner common.Hash
+	Root  common.Hash
+	Range PathRange
+}
+
+// IsStorage reports whether the range is within a storage trie
+func (tr TrieRange) IsStorage() bool { return tr.Owner != (common.Hash{}) }
+
+// WorkUnit is a set of trie ranges to be traversed together, with the estimated number of nodes
+// they contain
+type WorkUnit struct {
+	Tries          []TrieRange
+	EstimatedNodes uint64
+}
+
+// StoragePlanner partitions a state trie and all its storage tries into balanced work units.
+// Storage tries larger than SplitThreshold are cut into bins of their own, while smaller ones are
+// grouped into shared units of about TargetUnitSize nodes.
+type StoragePlanner struct {
+	sdb state.Database
+
+	// Estimated node count above which a storage trie is split into its own bins
+	SplitThreshold uint64
+	// Estimated node count to aim for in each work unit
+	TargetUnitSize uint64
+	// Depth below which nodes are read when estimating a trie's size
+	ProbeDepth int
+}
+
+func NewStoragePlanner(sdb state.Database) *StoragePlanner {
+	return &StoragePlanner{
+		sdb:            sdb,
+		SplitThreshold: 1 << 16,
+		TargetUnitSize: 1 << 14,
+		ProbeDepth:     2,
+	}
+}
+
+// Plan walks the accounts of the state trie at root, and returns a list of work units covering the
+// state trie, cut into `stateBins` bins, and all non-empty storage tries. Units are ordered by
+// decreasing size, so that scheduling them in order onto parallel workers balances the load.
+func (p *StoragePlanner) Plan(root common.Hash, stateBins uint) ([]WorkUnit, error) {
+	stateRanges, err := MakeRangesE(nil, stateBins)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := p.sdb.OpenTrie(root)
+	if err != nil {
+		return nil, err
+	}
+	stateSize, err := EstimateTrieSize(tree, p.ProbeDepth)
+	if err != nil {
+		return nil, err
+	}
+	var units []WorkUnit
+	for _, r := range stateRanges {
+		units = append(units, WorkUnit{
+			Tries:          []TrieRange{{Root: root, Range: r}},
+			EstimatedNodes: stateSize / uint64(stateBins),
+		})
+	}
+
+	var group WorkUnit
+	it := tree.NodeIterator(nil)
+	for it.Next(true) {
+		if !it.Leaf() {
+			continue
+		}
+		var account types.StateAccount
+		if err := rlp.DecodeBytes(it.LeafBlob(), &account); err != nil {
+			return nil, fmt.Errorf("bad account at %x: %w", it.LeafKey(), err)
+		}
+		if account.Root == types.EmptyRootHash || account.Root == (common.Hash{}) {
+			continue
+		}
+		owner := common.BytesToHash(it.LeafKey())
+		storage, err := p.sdb.OpenStorageTrie(owner, account.Root)
+		if err != nil {
+			return nil, err
+		}
+		size, err := EstimateTrieSize(storage, p.ProbeDepth)
+		if err != nil {
+			return nil, err
+		}
+		if size > p.SplitThreshold {
+			nbins := binsForSize(size, p.TargetUnitSize)
+			for _, r := range MakeRanges(nil, nbins) {
+				units = append(units, WorkUnit{
+					Tries:          []TrieRange{{Owner: owner, Root: account.Root, Range: r}},
+					EstimatedNodes: size / uint64(nbins),
+				})
+			}
+			continue
+		}
+		group.Tries = append(group.Tries, TrieRange{Owner: owner, Root: account.Root})
+		group.EstimatedNodes += size
+		if group.EstimatedNodes >= p.TargetUnitSize {
+			units = append(units, group)
+			group = WorkUnit{}
+		}
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	if len(group.Tries) > 0 {
+		units = append(units, group)
+	}
+	sort.SliceStable(units, func(i, j int) bool {
+		return units[i].EstimatedNodes > units[j].EstimatedNodes
+	})
+	return units, nil
+}
+
+// Execute traverses the units of a plan on `workers` goroutines, taking units in order, and calls
+// visit with an iterator over each of their trie ranges. The ranges of a split trie are cut as by
+// MakeRanges, so a node on a shared boundary is visited by both ranges; see AtSharedBoundary. The
+// first error from visit or an iterator cancels the remaining units and is returned.
+func (p *StoragePlanner) Execute(ctx context.Context, units []WorkUnit, workers int,
+	visit func(TrieRange, *PrefixBoundIterator) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		queue    = make(chan int)
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range queue {
+				for _, tr := range units[u].Tries {
+					if ctx.Err() != nil {
+						break
+					}
+					if err := p.visitRange(tr, visit); err != nil {
+						fail(fmt.Errorf("unit %d: %w", u, err))
+						break
+					}
+				}
+			}
+		}()
+	}
+feed:
+	for u := range units {
+		select {
+		case queue <- u:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return firstErr
+}
+
+func (p *StoragePlanner) visitRange(tr TrieRange, visit func(TrieRange, *PrefixBoundIterator) error) error {
+	var (
+		tree state.Trie
+		err  error
+	)
+	if tr.IsStorage() {
+		tree, err = p.sdb.OpenStorageTrie(tr.Owner, tr.Root)
+	} else {
+		tree, err = p.sdb.OpenTrie(tr.Root)
+	}
+	if err != nil {
+		return err
+	}
+	it := NewPrefixBoundIterator(tree.NodeIterator(HexToKeyBytes(tr.Range.Start)), tr.Range.Start, tr.Range.End)
+	if err := visit(tr, it); err != nil {
+		return err
+	}
+	return it.Error()
+}
+
+// smallest power of 2 which cuts size into bins no larger than target
+func binsForSize(size, target uint64) uint {
+	nbins := uint(1)
+	for target > 0 && size/uint64(nbins) > target && nbins < 1<<16 {
+		nbins <<= 1
+	}
+	return nbins
+}
+
+// EstimateTrieSize estimates the number of nodes in a trie by reading only its top `depth` levels.
+// If any subtries are cut off at that depth, the first of them is probed the same way and its size
+// is taken as that of each of them, which is a fair estimate as keys in secure tries are uniformly
+// distributed. Each probe reads on the order of 16^depth nodes, plus the siblings along the path
+// to it, so the cost grows only with the logarithm of the trie size.
+func EstimateTrieSize(tree state.Trie, depth int) (uint64, error) {
+	if depth < 1 {
+		depth = 1
+	}
+	return estimateSubtrie(tree, nil, depth)
+}
+
+// estimates the number of nodes within the subtrie at prefix
+func estimateSubtrie(tree state.Trie, prefix []byte, depth int) (uint64, error) {
+	var (
+		count, cut uint64
+		sample     []byte
+	)
+	it := tree.NodeIterator(nil)
+	for descend := true; it.Next(descend); {
+		path := it.Path()
+		if !bytes.HasPrefix(path, prefix) {
+			if bytes.Compare(path, prefix) > 0 {
+				break // past the subtrie
+			}
+			// only descend towards the subtrie
+			descend = bytes.HasPrefix(prefix, path)
+			continue
+		}
+		descend = len(path) < len(prefix)+depth
+		if descend || it.Leaf() {
+			count++
+			continue
+		}
+		if sample == nil {
+			sample = append([]byte{}, path...)
+		}
+		cut++
+	}
+	if err := it.Error(); err != nil {
+		return 0, err
+	}
+	if cut == 0 {
+		return count, nil
+	}
+	size, err := estimateSubtrie(tree, sample, depth)
+	if err != nil {
+		return 0, err
+	}
+	return count + cut*size, nil
+}
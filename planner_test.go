@@ -0,0 +1,188 @@
+package iterator_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+)
+
+// builds a state with one account per entry of `slots`, each with that many storage slots
+func newTestStateWithStorage(t *testing.T, slots []int) (state.Database, common.Hash) {
+	sdb := state.NewDatabase(rawdb.NewMemoryDatabase())
+	tree, err := sdb.OpenTrie(common.Hash{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, nslots := range slots {
+		addr := common.BigToAddress(big.NewInt(int64(i)))
+		account := types.StateAccount{Balance: common.Big1, Root: types.EmptyRootHash, CodeHash: crypto.Keccak256(nil)}
+		if nslots > 0 {
+			storage, err := sdb.OpenStorageTrie(crypto.Keccak256Hash(addr.Bytes()), common.Hash{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for s := 0; s < nslots; s++ {
+				slot := common.BigToHash(big.NewInt(int64(s)))
+				if err := storage.TryUpdate(slot.Bytes(), []byte{1, byte(s)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if account.Root, _, err = storage.Commit(nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tree.TryUpdateAccount(addr.Bytes(), &account); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root, _, err := tree.Commit(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sdb.TrieDB().Commit(root, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	return sdb, root
+}
+
+func TestStoragePlanner(t *testing.T) {
+	slots := []int{2000, 0, 3, 5, 0, 8, 10, 1, 4}
+	sdb, root := newTestStateWithStorage(t, slots)
+
+	planner := iter.NewStoragePlanner(sdb)
+	planner.SplitThreshold = 500
+	planner.TargetUnitSize = 300
+	units, err := planner.Plan(root, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stateRanges, splitRanges, grouped int
+	owners := make(map[common.Hash]bool)
+	for i, unit := range units {
+		if i > 0 && unit.EstimatedNodes > units[i-1].EstimatedNodes {
+			t.Fatal("units are not ordered by size")
+		}
+		for _, tr := range unit.Tries {
+			switch {
+			case !tr.IsStorage():
+				stateRanges++
+			case len(unit.Tries) == 1 && (tr.Range.Start != nil || tr.Range.End != nil):
+				splitRanges++
+				owners[tr.Owner] = true
+			default:
+				grouped++
+				owners[tr.Owner] = true
+			}
+		}
+	}
+	if stateRanges != 4 {
+		t.Errorf("wrong number of state ranges: %d", stateRanges)
+	}
+	if splitRanges < 2 {
+		t.Errorf("large storage trie was not split: %d ranges", splitRanges)
+	}
+	if grouped != 6 {
+		t.Errorf("wrong number of grouped storage tries: %d", grouped)
+	}
+	if len(owners) != 7 {
+		t.Errorf("wrong number of storage tries planned: %d", len(owners))
+	}
+}
+
+func TestEstimateTrieSize(t *testing.T) {
+	_, tree := newTestTrie(t, 5000, 1)
+	var exact uint64
+	for it := tree.NodeIterator(nil); it.Next(true); {
+		exact++
+	}
+	if size, _ := iter.EstimateTrieSize(tree, 64); size != exact {
+		t.Fatalf("wrong exact size; expected %d, have %d", exact, size)
+	}
+	for _, depth := range []int{2, 3} {
+		size, err := iter.EstimateTrieSize(tree, depth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size < exact/2 || size > exact*2 {
+			t.Fatalf("poor size estimate at depth %d; expected about %d, have %d", depth, exact, size)
+		}
+	}
+}
+
+func TestExecutePlan(t *testing.T) {
+	slots := []int{2000, 0, 3, 5, 0, 8, 10, 1, 4}
+	sdb, root := newTestStateWithStorage(t, slots)
+	planner := iter.NewStoragePlanner(sdb)
+	planner.SplitThreshold = 500
+	planner.TargetUnitSize = 300
+	units, err := planner.Plan(root, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every node of the state and storage tries is visited once, with nodes on a shared boundary
+	// left to the following range
+	var (
+		mu    sync.Mutex
+		nodes int
+	)
+	err = planner.Execute(context.Background(), units, 4, func(_ iter.TrieRange, it *iter.PrefixBoundIterator) error {
+		var n int
+		for it.Next(true) {
+			if !it.AtSharedBoundary() {
+				n++
+			}
+		}
+		mu.Lock()
+		nodes += n
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := state.New(root, sdb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := sdb.OpenTrie(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := countNodes(tree)
+	for i, nslots := range slots {
+		if nslots > 0 {
+			expected += countNodes(st.StorageTrie(common.BigToAddress(big.NewInt(int64(i)))))
+		}
+	}
+	if nodes != expected {
+		t.Fatalf("wrong node count; expected %d, have %d", expected, nodes)
+	}
+
+	failure := errors.New("failure")
+	err = planner.Execute(context.Background(), units, 2, func(iter.TrieRange, *iter.PrefixBoundIterator) error {
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected visit error, have %v", err)
+	}
+}
+
+func countNodes(tree state.Trie) int {
+	var n int
+	for it := tree.NodeIterator(nil); it.Next(true); {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,233 @@
+//
+// Copyright © 2022 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package iterator
+
+import (
+	"context"
+	"encoding/base32"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Tables and columns written by the snapshot sink, following the ipld-eth-db schema
+const (
+	StateCIDsTable   = "eth.state_cids"
+	StorageCIDsTable = "eth.storage_cids"
+	BlocksTable      = "ipld.blocks"
+)
+
+var (
+	StateCIDsColumns = []string{
+		"block_number", "header_id", "state_leaf_key", "cid", "state_path", "node_type", "diff", "mh_key",
+	}
+	StorageCIDsColumns = []string{
+		"block_number", "header_id", "state_path", "storage_leaf_key", "cid", "storage_path", "node_type", "diff", "mh_key",
+	}
+	BlocksColumns = []string{"block_number", "key", "data"}
+)
+
+// RowCopier bulk-inserts rows into a table, as with a Postgres COPY. A pgx connection can be
+// adapted to it by wrapping rows with pgx.CopyFromRows.
+type RowCopier interface {
+	CopyFrom(ctx context.Context, table string, columns []string, rows [][]interface{}) (int64, error)
+}
+
+// SnapshotConfig identifies the block and trie being written by a PGSnapshotSink
+type SnapshotConfig struct {
+	BlockNumber uint64
+	HeaderID    common.Hash
+	// Path of the owning account for a storage trie; nil when writing the state trie
+	StatePath []byte
+	// Number of nodes buffered per bin before a copy
+	BatchSize int
+}
+
+// PGSnapshotSink writes nodes into state_cids or storage_cids rows along with their IPLD blocks,
+// batching rows per bin. Copies are serialized, so the copier need not be safe for concurrent use.
+type PGSnapshotSink struct {
+	NopSink
+	ctx    context.Context
+	copier RowCopier
+	config SnapshotConfig
+
+	mu      sync.Mutex
+	pending map[uint]*rowBatch
+	copyMu  sync.Mutex
+}
+
+type rowBatch struct {
+	cids, blocks [][]interface{}
+}
+
+func NewPGSnapshotSink(ctx context.Context, copier RowCopier, config SnapshotConfig) *PGSnapshotSink {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 1024
+	}
+	return &PGSnapshotSink{ctx: ctx, copier: copier, config: config, pending: make(map[uint]*rowBatch)}
+}
+
+func (s *PGSnapshotSink) OnBinStart(bin uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[bin] = &rowBatch{}
+	return nil
+}
+
+func (s *PGSnapshotSink) OnNode(bin uint, node Node) error {
+	typ, frag, err := ResolveNodeType(node.Blob)
+	if err != nil {
+		return fmt.Errorf("bad node at path %x: %w", node.Path, err)
+	}
+	var leafKey interface{}
+	if typ == LeafNode {
+		key, err := HexToKeyBytesE(append(append([]byte{}, node.Path...), frag...))
+		if err != nil {
+			return fmt.Errorf("bad leaf key at path %x: %w", node.Path, err)
+		}
+		leafKey = common.BytesToHash(key).Hex()
+	}
+	codec := StateTrieCodec
+	if s.config.StatePath != nil {
+		codec = StorageTrieCodec
+	}
+	cid := NodeCID(codec, node.Hash)
+	mhKey := MultihashKey(node.Hash)
+	var row []interface{}
+	if s.config.StatePath == nil {
+		row = []interface{}{
+			s.config.BlockNumber, s.config.HeaderID.Hex(), leafKey, CIDString(cid), node.Path, int(typ), false, mhKey,
+		}
+	} else {
+		row = []interface{}{
+			s.config.BlockNumber, s.config.HeaderID.Hex(), s.config.StatePath, leafKey, CIDString(cid), node.Path, int(typ), false, mhKey,
+		}
+	}
+
+	s.mu.Lock()
+	batch := s.pending[bin]
+	s.mu.Unlock()
+	batch.cids = append(batch.cids, row)
+	batch.blocks = append(batch.blocks, []interface{}{s.config.BlockNumber, mhKey, node.Blob})
+	if len(batch.cids) >= s.config.BatchSize {
+		return s.flush(batch)
+	}
+	return nil
+}
+
+func (s *PGSnapshotSink) OnBinEnd(bin uint) error {
+	s.mu.Lock()
+	batch := s.pending[bin]
+	delete(s.pending, bin)
+	s.mu.Unlock()
+	return s.flush(batch)
+}
+
+func (s *PGSnapshotSink) flush(batch *rowBatch) error {
+	if len(batch.cids) == 0 {
+		return nil
+	}
+	table, columns := StateCIDsTable, StateCIDsColumns
+	if s.config.StatePath != nil {
+		table, columns = StorageCIDsTable, StorageCIDsColumns
+	}
+	s.copyMu.Lock()
+	defer s.copyMu.Unlock()
+	// blocks are written first, as the cids rows reference them
+	if _, err := s.copier.CopyFrom(s.ctx, BlocksTable, BlocksColumns, batch.blocks); err != nil {
+		return err
+	}
+	if _, err := s.copier.CopyFrom(s.ctx, table, columns, batch.cids); err != nil {
+		return err
+	}
+	batch.cids, batch.blocks = batch.cids[:0], batch.blocks[:0]
+	return nil
+}
+
+var (
+	base32Lower = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+	base32Upper = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+// CIDString returns the base32 multibase string of a binary CID
+func CIDString(cid []byte) string {
+	return "b" + base32Lower.EncodeToString(cid)
+}
+
+// MultihashKey returns the datastore key of a keccak-256 multihash, as used by ipld-eth-db
+func MultihashKey(hash common.Hash) string {
+	mh := appendUvarint(appendUvarint(nil, keccak256Multihash), common.HashLength)
+	return "/blocks/" + base32Upper.EncodeToString(append(mh, hash.Bytes()...))
+}
+
+// FileCopier is a RowCopier that appends rows to a CSV file per table within a directory, suitable
+// for a later COPY ... FROM ... CSV. Byte slices are written in Postgres bytea hex format.
+type FileCopier struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewFileCopier(dir string) *FileCopier {
+	return &FileCopier{dir: dir}
+}
+
+func (fc *FileCopier) CopyFrom(_ context.Context, table string, _ []string, rows [][]interface{}) (int64, error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	f, err := os.OpenFile(fc.TablePath(table), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	record := make([]string, 0)
+	for _, row := range rows {
+		record = record[:0]
+		for _, val := range row {
+			record = append(record, formatCSVValue(val))
+		}
+		if err := w.Write(record); err != nil {
+			return 0, err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return 0, err
+	}
+	return int64(len(rows)), f.Sync()
+}
+
+// TablePath returns the path of the CSV file written for a table
+func (fc *FileCopier) TablePath(table string) string {
+	return filepath.Join(fc.dir, strings.ReplaceAll(table, ".", "_")+".csv")
+}
+
+func formatCSVValue(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return fmt.Sprintf("\\x%x", v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
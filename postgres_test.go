@@ -0,0 +1,111 @@
+package iterator_test
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+)
+
+// in-memory fake for a database connection
+type memCopier struct {
+	mu     sync.Mutex
+	tables map[string][][]interface{}
+}
+
+func (mc *memCopier) CopyFrom(_ context.Context, table string, columns []string, rows [][]interface{}) (int64, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	for _, row := range rows {
+		if len(row) != len(columns) {
+			panic("row does not match columns")
+		}
+		mc.tables[table] = append(mc.tables[table], append([]interface{}{}, row...))
+	}
+	return int64(len(rows)), nil
+}
+
+func TestPGSnapshotSink(t *testing.T) {
+	_, tree := newTestTrie(t, 500, 1)
+	var nodes int
+	leafKeys := make(map[string]bool)
+	for it := tree.NodeIterator(nil); it.Next(true); {
+		if it.Leaf() {
+			leafKeys[common.BytesToHash(it.LeafKey()).Hex()] = true
+		} else if it.Hash() != (common.Hash{}) {
+			nodes++
+		}
+	}
+	config := iter.SnapshotConfig{BlockNumber: 1, HeaderID: common.HexToHash("0x01"), BatchSize: 10}
+
+	t.Run("state", func(t *testing.T) {
+		copier := &memCopier{tables: make(map[string][][]interface{})}
+		sink := iter.NewPGSnapshotSink(context.Background(), copier, config)
+		fac := iter.NewSubtrieIteratorFactory(tree, 16)
+		if err := iter.NewSinkRunner(&fac, sink).Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		rows := copier.tables[iter.StateCIDsTable]
+		if len(rows) != nodes || len(copier.tables[iter.BlocksTable]) != nodes {
+			t.Fatalf("wrong row count; expected %d, have %d", nodes, len(rows))
+		}
+		for _, row := range rows {
+			if row[5] == int(iter.LeafNode) && !leafKeys[row[2].(string)] {
+				t.Fatalf("unknown leaf key %v", row[2])
+			}
+		}
+		if len(copier.tables[iter.StorageCIDsTable]) != 0 {
+			t.Fatal("unexpected storage rows")
+		}
+	})
+
+	t.Run("storage to file", func(t *testing.T) {
+		storageConfig := config
+		storageConfig.StatePath = []byte{1, 2, 3}
+		copier := iter.NewFileCopier(t.TempDir())
+		sink := iter.NewPGSnapshotSink(context.Background(), copier, storageConfig)
+		fac := iter.NewSubtrieIteratorFactory(tree, 4)
+		if err := iter.NewSinkRunner(&fac, sink).Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(copier.TablePath(iter.StorageCIDsTable))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		records, err := csv.NewReader(f).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != nodes {
+			t.Fatalf("wrong row count; expected %d, have %d", nodes, len(records))
+		}
+		if records[0][2] != `\x010203` {
+			t.Fatalf("wrong state path %v", records[0][2])
+		}
+	})
+
+	t.Run("malformed leaf", func(t *testing.T) {
+		sink := iter.NewPGSnapshotSink(context.Background(), &memCopier{tables: make(map[string][][]interface{})}, config)
+		// a leaf whose path and key fragment make an odd number of nibbles
+		blob, err := rlp.EncodeToBytes([][]byte{iter.HexToCompact([]byte{1, 2, 16}), {1}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.OnBinStart(0); err != nil {
+			t.Fatal(err)
+		}
+		node := iter.Node{Path: []byte{3}, Hash: crypto.Keccak256Hash(blob), Blob: blob}
+		if err := sink.OnNode(0, node); !errors.Is(err, iter.ErrOddLengthPath) {
+			t.Fatalf("expected ErrOddLengthPath, have %v", err)
+		}
+	})
+}
@@ -0,0 +1,132 @@
+//
+// Copyright © 2022 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package iterator
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Prefetcher reads the children of trie nodes into a CachingStore ahead of iteration. Iterators
+// wrapped by it queue each node they visit, and a pool of workers fetches its children
+// concurrently, decoding the node from the cache which the iterator's own read filled. The
+// iterators themselves are unchanged, and so keep their exact order, but find the nodes they read
+// already cached. The tries iterated must be opened over the same store.
+//
+// The queue is bounded, and nodes are dropped rather than blocking iteration when it is full.
+// Prefetching is best-effort: failed reads are ignored, and surface only if the iterator itself
+// reads the node.
+type Prefetcher struct {
+	store *CachingStore
+	queue chan prefetchTask
+	wg    sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// a visited node whose children are to be fetched, if they lie within the iterator's end bound
+type prefetchTask struct {
+	hash      common.Hash
+	path, end []byte
+}
+
+// NewPrefetcher starts `parallelism` workers fetching into a store, with up to `buffer` nodes
+// queued
+func NewPrefetcher(store *CachingStore, parallelism, buffer int) *Prefetcher {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	p := &Prefetcher{store: store, queue: make(chan prefetchTask, buffer)}
+	p.wg.Add(parallelism)
+	for i := 0; i < parallelism; i++ {
+		go func() {
+			defer p.wg.Done()
+			for task := range p.queue {
+				p.fetchChildren(task)
+			}
+		}()
+	}
+	return p
+}
+
+func (p *Prefetcher) fetchChildren(task prefetchTask) {
+	blob, has := p.store.cached(task.hash)
+	if !has {
+		return // evicted, or the iterator's read failed
+	}
+	paths, hashes, err := childHashes(task.path, blob)
+	if err != nil {
+		return
+	}
+	for i, hash := range hashes {
+		if task.end != nil && bytes.Compare(paths[i], task.end) > 0 {
+			break // children are in path order, and the rest lie beyond the bound
+		}
+		p.store.Get(hash.Bytes())
+	}
+}
+
+// Close stops the workers once the queue is drained. Nodes visited after Close are not prefetched.
+func (p *Prefetcher) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.queue)
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+func (p *Prefetcher) enqueue(task prefetchTask) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return
+	}
+	select {
+	case p.queue <- task:
+	default:
+	}
+}
+
+// Wrap returns an iterator which prefetches the children of the nodes it visits, up to an
+// inclusive end path; a nil end is unbounded
+func (p *Prefetcher) Wrap(it trie.NodeIterator, end []byte) trie.NodeIterator {
+	return &prefetchIterator{NodeIterator: it, p: p, end: end}
+}
+
+type prefetchIterator struct {
+	trie.NodeIterator
+	p   *Prefetcher
+	end []byte
+}
+
+func (it *prefetchIterator) Next(descend bool) bool {
+	if !it.NodeIterator.Next(descend) {
+		return false
+	}
+	if hash := it.Hash(); hash != (common.Hash{}) {
+		it.p.enqueue(prefetchTask{hash: hash, path: copyBytes(it.Path()), end: it.end})
+	}
+	return true
+}
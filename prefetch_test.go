@@ -0,0 +1,99 @@
+package iterator_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/trie"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+)
+
+func TestPrefetcher(t *testing.T) {
+	_, tree := newTestTrie(t, 1000, 1)
+	db, _, err := iter.CopyStateToMemory(tree, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		expected [][]byte
+		nodes    uint64
+	)
+	for it := tree.NodeIterator(nil); it.Next(true); {
+		expected = append(expected, append([]byte{}, it.Path()...))
+		if it.Hash() != (common.Hash{}) {
+			nodes++
+		}
+	}
+
+	// iteration order is unchanged, and each node is read once by the iterator and at most once
+	// by the prefetcher
+	cache := iter.NewCachingStore(db, 1<<24)
+	prefetcher := iter.NewPrefetcher(cache, 4, 64)
+	copied, err := iter.OpenTrieFromStore(cache, tree.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	it := prefetcher.Wrap(copied.NodeIterator(nil), nil)
+	checkRangeCoverage(t, []trie.NodeIterator{it}, []iter.PathRange{{}}, expected)
+	prefetcher.Close()
+	if stats := cache.Stats(); stats.Hits+stats.Misses+stats.Shared > 2*nodes {
+		t.Fatalf("too many reads of %d nodes: %+v", nodes, stats)
+	}
+
+	// children are fetched ahead of the iterator
+	cache = iter.NewCachingStore(db, 1<<24)
+	prefetcher = iter.NewPrefetcher(cache, 4, 64)
+	if copied, err = iter.OpenTrieFromStore(cache, tree.Hash()); err != nil {
+		t.Fatal(err)
+	}
+	it = prefetcher.Wrap(copied.NodeIterator(nil), nil)
+	if !it.Next(true) {
+		t.Fatal("expected root node")
+	}
+	prefetcher.Close()
+	if entries := cache.Stats().Entries; entries < 17 {
+		t.Fatalf("root children not prefetched: %d cached nodes", entries)
+	}
+	// nodes visited after Close are not prefetched
+	for it.Next(true) {
+	}
+	if err := it.Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	// children beyond the end bound are not fetched
+	cache = iter.NewCachingStore(db, 1<<24)
+	prefetcher = iter.NewPrefetcher(cache, 4, 1024)
+	if copied, err = iter.OpenTrieFromStore(cache, tree.Hash()); err != nil {
+		t.Fatal(err)
+	}
+	end := []byte{0, 8}
+	var visited uint64
+	for it := iter.NewPrefixBoundIterator(prefetcher.Wrap(copied.NodeIterator(nil), end), nil, end); it.Next(true); {
+		if it.Hash() != (common.Hash{}) {
+			visited++
+		}
+	}
+	prefetcher.Close()
+	// the iterator reads one node past its bound before stopping
+	if entries := cache.Stats().Entries; entries > visited+1 {
+		t.Fatalf("nodes beyond the bound prefetched: %d cached, %d visited", entries, visited)
+	}
+
+	t.Run("runner", func(t *testing.T) {
+		cache := iter.NewCachingStore(db, 1<<24)
+		prefetcher := iter.NewPrefetcher(cache, 8, 256)
+		defer prefetcher.Close()
+		fac, err := iter.NewSubtrieIteratorFactoryFromStore(cache, tree.Hash(), 16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runner := iter.NewSinkRunner(&fac, iter.NewVerifyingSink())
+		runner.Prefetcher = prefetcher
+		if err := runner.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
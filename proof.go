@@ -0,0 +1,151 @@
+//
+// Copyright © 2022 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package iterator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// ErrInvalidRangeProof is returned when a bin's leaves cannot be proven against a root
+var ErrInvalidRangeProof = errors.New("invalid range proof")
+
+// RangeProof proves that a list of leaves is exactly the contents of a bin, in the manner of
+// snap sync: edge proofs for the bin's first and last possible keys let a verifier rebuild the
+// trie from the leaves and check it against the root.
+type RangeProof struct {
+	// Nodes of the edge proofs
+	Nodes [][]byte
+	// For an empty bin, the first leaf following it, if any
+	NextKey, NextValue []byte
+}
+
+// collects the nodes of merkle proofs
+type proofList struct {
+	nodes [][]byte
+	seen  map[string]struct{}
+}
+
+func (l *proofList) Put(key, value []byte) error {
+	if _, has := l.seen[string(key)]; !has {
+		l.seen[string(key)] = struct{}{}
+		l.nodes = append(l.nodes, copyBytes(value))
+	}
+	return nil
+}
+
+func (l *proofList) Delete([]byte) error { return nil }
+
+// Returns the first and last keys that can lie within a bin's range
+func binKeyBounds(r PathRange) (origin, limit []byte) {
+	start, end := keyRange(r)
+	origin = start[:]
+	limit = bytes.Repeat([]byte{0xff}, common.HashLength)
+	if end != nil {
+		// decrement the end bound, filling with 0xff
+		copy(limit, end)
+		for i := len(end) - 1; i >= 0; i-- {
+			limit[i]--
+			if limit[i] != 0xff {
+				break
+			}
+		}
+	}
+	return
+}
+
+// ProveBin returns the leaves of a bin, with a proof of their completeness against the trie root
+func (fac *SubtrieIteratorFactory) ProveBin(bin uint) (keys, values [][]byte, proof *RangeProof, err error) {
+	proof = &RangeProof{}
+	it := fac.IteratorAt(bin)
+	for it.Next(true) {
+		if it.Leaf() {
+			keys = append(keys, copyBytes(it.LeafKey()))
+			values = append(values, copyBytes(it.LeafBlob()))
+		}
+	}
+	if err = it.Error(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	tree := fac.treeCopy()
+	origin, limit := binKeyBounds(PathRange{Start: fac.startPaths[bin], End: fac.endPaths[bin]})
+	if len(keys) == 0 {
+		// prove the bin empty by the leaf following it
+		next := trie.NewIterator(tree.NodeIterator(origin))
+		if next.Next() {
+			proof.NextKey, proof.NextValue = next.Key, next.Value
+			limit = next.Key
+		} else if err = next.Err; err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	nodes := &proofList{seen: make(map[string]struct{})}
+	if err = tree.Prove(origin, 0, nodes); err != nil {
+		return nil, nil, nil, err
+	}
+	if err = tree.Prove(limit, 0, nodes); err != nil {
+		return nil, nil, nil, err
+	}
+	proof.Nodes = nodes.nodes
+	return keys, values, proof, nil
+}
+
+// VerifyBinProof checks that the given leaves are exactly the contents of the range r of the trie at
+// root. The range is supplied by the verifier, as a proof only covers the range it was made for.
+func VerifyBinProof(root common.Hash, r PathRange, keys, values [][]byte, proof *RangeProof) error {
+	if proof == nil {
+		return fmt.Errorf("%w: missing proof", ErrInvalidRangeProof)
+	}
+	db := memorydb.New()
+	for _, node := range proof.Nodes {
+		if err := db.Put(crypto.Keccak256(node), node); err != nil {
+			return err
+		}
+	}
+	origin, limit := binKeyBounds(r)
+	for _, key := range keys {
+		if bytes.Compare(key, origin) < 0 || bytes.Compare(key, limit) > 0 {
+			return fmt.Errorf("%w: leaf %x outside of bin", ErrInvalidRangeProof, key)
+		}
+	}
+
+	var err error
+	switch {
+	case len(keys) > 0:
+		_, err = trie.VerifyRangeProof(root, origin, limit, keys, values, db)
+	case proof.NextKey == nil:
+		// no leaves at or after the bin
+		_, err = trie.VerifyRangeProof(root, origin, nil, nil, nil, db)
+	case bytes.Compare(proof.NextKey, limit) <= 0:
+		err = fmt.Errorf("following leaf %x is inside bin", proof.NextKey)
+	default:
+		// no leaves between the bin start and the leaf following it
+		_, err = trie.VerifyRangeProof(root, origin, proof.NextKey,
+			[][]byte{proof.NextKey}, [][]byte{proof.NextValue}, db)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRangeProof, err)
+	}
+	return nil
+}
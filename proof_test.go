@@ -0,0 +1,70 @@
+package iterator_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+)
+
+func TestRangeProof(t *testing.T) {
+	for _, nleaves := range []int{3, 500} {
+		_, tree := newTestTrie(t, nleaves, 1)
+		for _, nbins := range []uint{1, 2, 16, 256} {
+			t.Run(fmt.Sprintf("%d leaves, %d bins", nleaves, nbins), func(t *testing.T) {
+				fac := iter.NewSubtrieIteratorFactory(tree, nbins)
+				ranges := iter.MakeRanges(nil, nbins)
+				var total int
+				for b := uint(0); b < uint(fac.Length()); b++ {
+					keys, values, proof, err := fac.ProveBin(b)
+					if err != nil {
+						t.Fatal(err)
+					}
+					total += len(keys)
+					if err := iter.VerifyBinProof(tree.Hash(), ranges[b], keys, values, proof); err != nil {
+						t.Fatalf("bin %d: %v", b, err)
+					}
+					if len(keys) == 0 {
+						continue
+					}
+
+					// a proof does not cover other ranges
+					for _, other := range []iter.PathRange{ranges[(b+1)%nbins], {}} {
+						if nbins == 1 {
+							break
+						}
+						err = iter.VerifyBinProof(tree.Hash(), other, keys, values, proof)
+						if !errors.Is(err, iter.ErrInvalidRangeProof) {
+							t.Fatalf("bin %d: expected invalid proof for range %v, have %v", b, other, err)
+						}
+					}
+
+					// a missing leaf is detected
+					err = iter.VerifyBinProof(tree.Hash(), ranges[b], keys[1:], values[1:], proof)
+					if !errors.Is(err, iter.ErrInvalidRangeProof) {
+						t.Fatalf("bin %d: expected invalid proof for missing leaf, have %v", b, err)
+					}
+					err = iter.VerifyBinProof(tree.Hash(), ranges[b], nil, nil, proof)
+					if !errors.Is(err, iter.ErrInvalidRangeProof) {
+						t.Fatalf("bin %d: expected invalid proof for empty leaves, have %v", b, err)
+					}
+					// as is a modified value
+					modified := append([][]byte{}, values...)
+					modified[0] = append([]byte{}, values[0]...)
+					modified[0][0]++
+					err = iter.VerifyBinProof(tree.Hash(), ranges[b], keys, modified, proof)
+					if !errors.Is(err, iter.ErrInvalidRangeProof) {
+						t.Fatalf("bin %d: expected invalid proof for modified value, have %v", b, err)
+					}
+				}
+				if err := iter.VerifyBinProof(tree.Hash(), ranges[0], nil, nil, nil); !errors.Is(err, iter.ErrInvalidRangeProof) {
+					t.Fatalf("expected invalid proof for missing proof, have %v", err)
+				}
+				if total != nleaves {
+					t.Fatalf("wrong leaf count; expected %d, have %d", nleaves, total)
+				}
+			})
+		}
+	}
+}
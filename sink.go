@@ -0,0 +1,216 @@
+//
+// Copyright © 2022 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package iterator
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Node is a standalone (hash-referenced) trie node yielded during iteration
+type Node struct {
+	Path []byte
+	Hash common.Hash
+	Blob []byte
+}
+
+// Leaf is a value stored in a trie, with its full hex path
+type Leaf struct {
+	Path  []byte
+	Key   []byte
+	Value []byte
+}
+
+// NodeSink receives the output of a partitioned traversal. Bins are processed concurrently, so a
+// sink shared by a runner must be safe for concurrent use across bins; calls for any single bin
+// are sequential and in iteration order.
+type NodeSink interface {
+	OnBinStart(bin uint) error
+	OnNode(bin uint, node Node) error
+	OnLeaf(bin uint, leaf Leaf) error
+	OnBinEnd(bin uint) error
+	// Close is called once after all bins have completed or the run is aborted
+	Close() error
+}
+
+// SinkRunner drives the bins of a factory into a set of sinks. Each node is delivered exactly
+// once: nodes on a shared bin boundary are only delivered to the later bin.
+type SinkRunner struct {
+	factory BinIteratorFactory
+	sinks   []NodeSink
+
+	// Number of bins processed at once
+	Workers int
+	// Number of nodes buffered per bin before they are passed to the sinks
+	BatchSize int
+	// Optional limit on the nodes visited per second, shared across all bins
+	Limiter Limiter
+	// Optional prefetcher for the store the factory's trie is read from
+	Prefetcher *Prefetcher
+}
+
+// sinkItem is a buffered node or leaf
+type sinkItem struct {
+	node *Node
+	leaf *Leaf
+}
+
+func NewSinkRunner(fac BinIteratorFactory, sinks ...NodeSink) *SinkRunner {
+	return &SinkRunner{
+		factory:   fac,
+		sinks:     sinks,
+		Workers:   runtime.NumCPU(),
+		BatchSize: 1024,
+	}
+}
+
+// Run processes all bins, then closes the sinks. The first error from any bin or sink cancels the
+// remaining work and is returned.
+func (r *SinkRunner) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		bins     = make(chan uint)
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+	workers := r.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for bin := range bins {
+				if err := r.runBin(ctx, bin); err != nil {
+					fail(fmt.Errorf("bin %d: %w", bin, err))
+				}
+			}
+		}()
+	}
+feed:
+	for b := 0; b < r.factory.Length(); b++ {
+		select {
+		case bins <- uint(b):
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(bins)
+	wg.Wait()
+
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	for _, sink := range r.sinks {
+		if err := sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (r *SinkRunner) runBin(ctx context.Context, bin uint) error {
+	for _, sink := range r.sinks {
+		if err := sink.OnBinStart(bin); err != nil {
+			return err
+		}
+	}
+	batch := make([]sinkItem, 0, r.BatchSize)
+	flush := func() error {
+		for _, sink := range r.sinks {
+			for _, item := range batch {
+				var err error
+				if item.leaf != nil {
+					err = sink.OnLeaf(bin, *item.leaf)
+				} else {
+					err = sink.OnNode(bin, *item.node)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	it := r.factory.IteratorAt(bin)
+	if r.Prefetcher != nil {
+		it.NodeIterator = r.Prefetcher.Wrap(it.NodeIterator, it.EndPath)
+	}
+	for it.Next(true) {
+		if r.Limiter != nil {
+			if err := r.Limiter.Wait(ctx, 1); err != nil {
+				return err
+			}
+		}
+		if it.AtSharedBoundary() {
+			continue
+		}
+		if it.Leaf() {
+			batch = append(batch, sinkItem{leaf: &Leaf{
+				Path:  copyBytes(it.Path()),
+				Key:   copyBytes(it.LeafKey()),
+				Value: copyBytes(it.LeafBlob()),
+			}})
+		} else if hash := it.Hash(); hash != (common.Hash{}) {
+			blob := it.NodeBlob()
+			if blob == nil {
+				break
+			}
+			batch = append(batch, sinkItem{node: &Node{Path: copyBytes(it.Path()), Hash: hash, Blob: blob}})
+		}
+		if len(batch) >= r.BatchSize {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	for _, sink := range r.sinks {
+		if err := sink.OnBinEnd(bin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyBytes(b []byte) []byte {
+	return append([]byte(nil), b...)
+}
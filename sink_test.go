@@ -0,0 +1,64 @@
+package iterator_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+)
+
+type failingSink struct {
+	iter.NopSink
+	closed bool
+}
+
+var errSinkFailed = errors.New("sink failed")
+
+func (s *failingSink) OnLeaf(uint, iter.Leaf) error { return errSinkFailed }
+func (s *failingSink) Close() error                 { s.closed = true; return nil }
+
+func TestSinkRunner(t *testing.T) {
+	_, tree := newTestTrie(t, 1000, 1)
+	var nodes, leaves uint64
+	for it := tree.NodeIterator(nil); it.Next(true); {
+		if it.Leaf() {
+			leaves++
+		} else if it.Hash() != (common.Hash{}) {
+			nodes++
+		}
+	}
+
+	for _, nbins := range []uint{1, 2, 16, 32, 256} {
+		t.Run(fmt.Sprintf("%d bins", nbins), func(t *testing.T) {
+			counter := iter.NewCountingSink()
+			fac := iter.NewSubtrieIteratorFactory(tree, nbins)
+			runner := iter.NewSinkRunner(&fac, counter, iter.NewVerifyingSink())
+			runner.BatchSize = 7
+			if err := runner.Run(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if counter.Nodes() != nodes {
+				t.Errorf("wrong node count; expected %d, have %d", nodes, counter.Nodes())
+			}
+			if counter.Leaves() != leaves {
+				t.Errorf("wrong leaf count; expected %d, have %d", leaves, counter.Leaves())
+			}
+		})
+	}
+
+	t.Run("sink error", func(t *testing.T) {
+		sink := &failingSink{}
+		fac := iter.NewSubtrieIteratorFactory(tree, 16)
+		err := iter.NewSinkRunner(&fac, sink).Run(context.Background())
+		if !errors.Is(err, errSinkFailed) {
+			t.Fatalf("expected sink error, have %v", err)
+		}
+		if !sink.closed {
+			t.Fatal("sink was not closed")
+		}
+	})
+}
@@ -0,0 +1,269 @@
+//
+// Copyright © 2022 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package iterator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+var (
+	// ErrNodeHashMismatch is returned by a VerifyingSink for a node whose content does not match its hash
+	ErrNodeHashMismatch = errors.New("node hash mismatch")
+	// ErrPathOrder is returned by a VerifyingSink when a bin's paths are not strictly increasing
+	ErrPathOrder = errors.New("paths out of order")
+)
+
+// NopSink implements NodeSink with no-op methods, for embedding in sinks which only need some of them
+type NopSink struct{}
+
+func (NopSink) OnBinStart(uint) error   { return nil }
+func (NopSink) OnNode(uint, Node) error { return nil }
+func (NopSink) OnLeaf(uint, Leaf) error { return nil }
+func (NopSink) OnBinEnd(uint) error     { return nil }
+func (NopSink) Close() error            { return nil }
+
+// CountingSink counts the nodes and leaves delivered to it
+type CountingSink struct {
+	NopSink
+	mu       sync.Mutex
+	nodes    uint64
+	leaves   uint64
+	binNodes map[uint]uint64
+}
+
+func NewCountingSink() *CountingSink {
+	return &CountingSink{binNodes: make(map[uint]uint64)}
+}
+
+func (s *CountingSink) OnNode(bin uint, _ Node) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nodes++
+	s.binNodes[bin]++
+	return nil
+}
+
+func (s *CountingSink) OnLeaf(uint, Leaf) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.leaves++
+	return nil
+}
+
+// Nodes returns the total number of nodes counted
+func (s *CountingSink) Nodes() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nodes
+}
+
+// Leaves returns the total number of leaves counted
+func (s *CountingSink) Leaves() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.leaves
+}
+
+// BinNodes returns the number of nodes counted in a bin
+func (s *CountingSink) BinNodes(bin uint) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.binNodes[bin]
+}
+
+// ImportSink writes nodes into a key-value store, batched per bin
+type ImportSink struct {
+	NopSink
+	dst     ethdb.KeyValueStore
+	mu      sync.Mutex
+	batches map[uint]ethdb.Batch
+}
+
+func NewImportSink(dst ethdb.KeyValueStore) *ImportSink {
+	return &ImportSink{dst: dst, batches: make(map[uint]ethdb.Batch)}
+}
+
+func (s *ImportSink) batch(bin uint) ethdb.Batch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch, has := s.batches[bin]
+	if !has {
+		batch = s.dst.NewBatch()
+		s.batches[bin] = batch
+	}
+	return batch
+}
+
+func (s *ImportSink) OnNode(bin uint, node Node) error {
+	batch := s.batch(bin)
+	rawdb.WriteTrieNode(batch, node.Hash, node.Blob)
+	if batch.ValueSize() >= ethdb.IdealBatchSize {
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		batch.Reset()
+	}
+	return nil
+}
+
+func (s *ImportSink) OnBinEnd(bin uint) error {
+	err := s.batch(bin).Write()
+	s.mu.Lock()
+	delete(s.batches, bin)
+	s.mu.Unlock()
+	return err
+}
+
+// CARSink writes nodes as blocks of a single codec to a shared CAR
+type CARSink struct {
+	NopSink
+	cw    *CARWriter
+	codec uint64
+}
+
+func NewCARSink(cw *CARWriter, codec uint64) *CARSink {
+	return &CARSink{cw: cw, codec: codec}
+}
+
+func (s *CARSink) OnNode(_ uint, node Node) error {
+	return s.cw.Put(NodeCID(s.codec, node.Hash), node.Blob)
+}
+
+func (s *CARSink) Close() error { return s.cw.Flush() }
+
+// BinCARSink writes the nodes of each bin to its own CAR file, named bin-<n>.car
+type BinCARSink struct {
+	dir   string
+	root  []byte
+	codec uint64
+	mu    sync.Mutex
+	open  map[uint]*binCAR
+}
+
+type binCAR struct {
+	file *os.File
+	cw   *CARWriter
+}
+
+func NewBinCARSink(dir string, root []byte, codec uint64) *BinCARSink {
+	return &BinCARSink{dir: dir, root: root, codec: codec, open: make(map[uint]*binCAR)}
+}
+
+func (s *BinCARSink) OnBinStart(bin uint) error {
+	f, err := os.Create(filepath.Join(s.dir, fmt.Sprintf("bin-%d.car", bin)))
+	if err != nil {
+		return err
+	}
+	cw, err := NewCARWriter(f, s.root)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.mu.Lock()
+	s.open[bin] = &binCAR{file: f, cw: cw}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *BinCARSink) OnNode(bin uint, node Node) error {
+	s.mu.Lock()
+	out := s.open[bin]
+	s.mu.Unlock()
+	return out.cw.Put(NodeCID(s.codec, node.Hash), node.Blob)
+}
+
+func (s *BinCARSink) OnLeaf(uint, Leaf) error { return nil }
+
+func (s *BinCARSink) OnBinEnd(bin uint) error {
+	s.mu.Lock()
+	out := s.open[bin]
+	delete(s.open, bin)
+	s.mu.Unlock()
+	return out.close()
+}
+
+// Close closes the files of any bins which did not complete
+func (s *BinCARSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for bin, out := range s.open {
+		out.file.Close()
+		delete(s.open, bin)
+	}
+	return nil
+}
+
+func (out *binCAR) close() error {
+	if err := out.cw.Flush(); err != nil {
+		out.file.Close()
+		return err
+	}
+	if err := out.file.Sync(); err != nil {
+		out.file.Close()
+		return err
+	}
+	return out.file.Close()
+}
+
+// VerifyingSink checks that node contents match their hashes, and that each bin's paths are
+// strictly increasing
+type VerifyingSink struct {
+	NopSink
+	mu   sync.Mutex
+	last map[uint][]byte
+}
+
+func NewVerifyingSink() *VerifyingSink {
+	return &VerifyingSink{last: make(map[uint][]byte)}
+}
+
+func (s *VerifyingSink) OnNode(bin uint, node Node) error {
+	if crypto.Keccak256Hash(node.Blob) != node.Hash {
+		return fmt.Errorf("%w at path %x", ErrNodeHashMismatch, node.Path)
+	}
+	return s.checkOrder(bin, node.Path)
+}
+
+func (s *VerifyingSink) OnLeaf(bin uint, leaf Leaf) error {
+	return s.checkOrder(bin, leaf.Path)
+}
+
+func (s *VerifyingSink) OnBinEnd(bin uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.last, bin)
+	return nil
+}
+
+func (s *VerifyingSink) checkOrder(bin uint, path []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if last, has := s.last[bin]; has && bytes.Compare(last, path) >= 0 {
+		return fmt.Errorf("%w: %x follows %x", ErrPathOrder, path, last)
+	}
+	s.last[bin] = path
+	return nil
+}
@@ -0,0 +1,193 @@
+//
+// Copyright © 2022 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package iterator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+)
+
+// ErrSnapshotMismatch is returned when the snapshot and trie leaves of a bin differ
+var ErrSnapshotMismatch = errors.New("snapshot does not match trie")
+
+// A bin's leaves are exactly those whose keys fall in a key range: since leaf paths are full
+// length, a leaf is never on a bin boundary, so the inclusive end bound of the trie iterator
+// excludes every key under the end path.
+func keyRange(r PathRange) (start common.Hash, end []byte) {
+	copy(start[:], HexToKeyBytesPadded(r.Start))
+	if r.End != nil {
+		end = HexToKeyBytesPadded(r.End)
+	}
+	return
+}
+
+// SnapshotIteratorFactory yields iterators over the flat snapshot of the account or a storage
+// trie, covering the same leaves as the bins of a SubtrieIteratorFactory
+type SnapshotIteratorFactory struct {
+	snaps   *snapshot.Tree
+	root    common.Hash
+	account *common.Hash // nil for the account trie
+	ranges  []PathRange
+}
+
+// NewSnapshotIteratorFactory cuts the snapshot accounts at state root into `nbins` bins
+func NewSnapshotIteratorFactory(snaps *snapshot.Tree, root common.Hash, nbins uint) (SnapshotIteratorFactory, error) {
+	ranges, err := MakeRangesE(nil, nbins)
+	if err != nil {
+		return SnapshotIteratorFactory{}, err
+	}
+	return SnapshotIteratorFactory{snaps: snaps, root: root, ranges: ranges}, nil
+}
+
+// NewStorageSnapshotIteratorFactory cuts the snapshot storage of an account (by address hash) at
+// state root into `nbins` bins
+func NewStorageSnapshotIteratorFactory(snaps *snapshot.Tree, root, account common.Hash, nbins uint) (SnapshotIteratorFactory, error) {
+	fac, err := NewSnapshotIteratorFactory(snaps, root, nbins)
+	fac.account = &account
+	return fac, err
+}
+
+func (fac *SnapshotIteratorFactory) Length() int { return len(fac.ranges) }
+
+// IteratorAt returns an iterator over the leaves of a bin. It must be released after use.
+func (fac *SnapshotIteratorFactory) IteratorAt(bin uint) (*SnapshotLeafIterator, error) {
+	seek, end := keyRange(fac.ranges[bin])
+	if fac.account == nil {
+		it, err := fac.snaps.AccountIterator(fac.root, seek)
+		if err != nil {
+			return nil, err
+		}
+		return &SnapshotLeafIterator{it: it, end: end, value: func() ([]byte, error) {
+			return snapshot.FullAccountRLP(it.Account())
+		}}, nil
+	}
+	it, err := fac.snaps.StorageIterator(fac.root, *fac.account, seek)
+	if err != nil {
+		return nil, err
+	}
+	return &SnapshotLeafIterator{it: it, end: end, value: func() ([]byte, error) {
+		return it.Slot(), nil
+	}}, nil
+}
+
+// SnapshotLeafIterator iterates the leaves of a key range in a snapshot. Values are given in the
+// same encoding as the trie leaves, so accounts are converted from the snapshot's slim format.
+type SnapshotLeafIterator struct {
+	it  snapshot.Iterator
+	end []byte
+	// returns the current value in trie leaf encoding
+	value func() ([]byte, error)
+	leaf  []byte
+	err   error
+}
+
+func (it *SnapshotLeafIterator) Next() bool {
+	if it.err != nil || !it.it.Next() {
+		return false
+	}
+	key := it.it.Hash()
+	if it.end != nil && bytes.Compare(key[:], it.end) >= 0 {
+		return false
+	}
+	it.leaf, it.err = it.value()
+	return it.err == nil
+}
+
+// Key returns the hashed key of the current leaf
+func (it *SnapshotLeafIterator) Key() common.Hash { return it.it.Hash() }
+
+// Value returns the value of the current leaf
+func (it *SnapshotLeafIterator) Value() []byte { return it.leaf }
+
+func (it *SnapshotLeafIterator) Error() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.it.Error()
+}
+
+func (it *SnapshotLeafIterator) Release() { it.it.Release() }
+
+// CheckSnapshotBin checks that a snapshot iterator yields exactly the leaves of a trie iterator
+func CheckSnapshotBin(tit *PrefixBoundIterator, sit *SnapshotLeafIterator) error {
+	for {
+		var trieKey []byte
+		for tit.Next(true) {
+			if tit.Leaf() {
+				trieKey = tit.LeafKey()
+				break
+			}
+		}
+		if err := tit.Error(); err != nil {
+			return err
+		}
+		hasSnap := sit.Next()
+		if err := sit.Error(); err != nil {
+			return err
+		}
+		switch {
+		case trieKey == nil && !hasSnap:
+			return nil
+		case trieKey == nil:
+			return fmt.Errorf("%w: extra snapshot leaf %x", ErrSnapshotMismatch, sit.Key())
+		case !hasSnap:
+			return fmt.Errorf("%w: missing snapshot leaf %x", ErrSnapshotMismatch, trieKey)
+		case !bytes.Equal(trieKey, sit.Key().Bytes()):
+			return fmt.Errorf("%w: snapshot leaf %x, trie leaf %x", ErrSnapshotMismatch, sit.Key(), trieKey)
+		case !bytes.Equal(tit.LeafBlob(), sit.Value()):
+			return fmt.Errorf("%w: value of leaf %x", ErrSnapshotMismatch, trieKey)
+		}
+	}
+}
+
+// CheckSnapshot cross-checks each bin of a snapshot against the same bin of a trie, in parallel
+func CheckSnapshot(fac SubtrieIteratorFactory, snaps SnapshotIteratorFactory) error {
+	if fac.Length() != snaps.Length() {
+		return fmt.Errorf("bin counts differ: trie %d, snapshot %d", fac.Length(), snaps.Length())
+	}
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, fac.Length())
+	)
+	for bin := 0; bin < fac.Length(); bin++ {
+		wg.Add(1)
+		go func(bin uint) {
+			defer wg.Done()
+			sit, err := snaps.IteratorAt(bin)
+			if err != nil {
+				errs[bin] = err
+				return
+			}
+			defer sit.Release()
+			if err := CheckSnapshotBin(fac.IteratorAt(bin), sit); err != nil {
+				errs[bin] = fmt.Errorf("bin %d: %w", bin, err)
+			}
+		}(uint(bin))
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
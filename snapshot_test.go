@@ -0,0 +1,92 @@
+package iterator_test
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+)
+
+func TestSnapshotIterator(t *testing.T) {
+	slots := make([]int, 300)
+	slots[0] = 1000
+	slots[7] = 20
+	sdb, root := newTestStateWithStorage(t, slots)
+	diskdb := sdb.TrieDB().DiskDB()
+	snaps, err := snapshot.New(diskdb, sdb.TrieDB(), 16, root, false, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := sdb.OpenTrie(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, nbins := range []uint{1, 2, 16, 32, 256} {
+		t.Run(fmt.Sprintf("%d bins", nbins), func(t *testing.T) {
+			fac, err := iter.NewSnapshotIteratorFactory(snaps, root, nbins)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var leaves int
+			for b := uint(0); b < uint(fac.Length()); b++ {
+				it, err := fac.IteratorAt(b)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for it.Next() {
+					leaves++
+				}
+				if err := it.Error(); err != nil {
+					t.Fatal(err)
+				}
+				it.Release()
+			}
+			if leaves != len(slots) {
+				t.Fatalf("wrong leaf count; expected %d, have %d", len(slots), leaves)
+			}
+			if err := iter.CheckSnapshot(iter.NewSubtrieIteratorFactory(tree, nbins), fac); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	t.Run("storage", func(t *testing.T) {
+		addrHash := crypto.Keccak256Hash(common.BigToAddress(big.NewInt(0)).Bytes())
+		account, err := snaps.Snapshot(root).Account(addrHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		storage, err := sdb.OpenStorageTrie(addrHash, common.BytesToHash(account.Root))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fac, err := iter.NewStorageSnapshotIteratorFactory(snaps, root, addrHash, 16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := iter.CheckSnapshot(iter.NewSubtrieIteratorFactory(storage, 16), fac); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		extra := common.HexToHash("0x9000000000000000000000000000000000000000000000000000000000000000")
+		rawdb.WriteAccountSnapshot(diskdb, extra, snapshot.SlimAccountRLP(0, common.Big1, common.Hash{}, nil))
+		fac, err := iter.NewSnapshotIteratorFactory(snaps, root, 16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = iter.CheckSnapshot(iter.NewSubtrieIteratorFactory(tree, 16), fac)
+		if !errors.Is(err, iter.ErrSnapshotMismatch) {
+			t.Fatalf("expected mismatch error, have %v", err)
+		}
+	})
+}
@@ -0,0 +1,241 @@
+//
+// Copyright © 2022 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package iterator
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Limiter paces operations shared across concurrent iterators
+type Limiter interface {
+	// Wait blocks until n operations are permitted, or the context is done
+	Wait(ctx context.Context, n int) error
+}
+
+// RateLimiter is a token bucket Limiter permitting a steady rate of operations with bursts. It is
+// safe for concurrent use.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // per second
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+// NewRateLimiter creates a limiter permitting `rate` operations per second, and up to `burst` at
+// once. A non-positive rate is unlimited.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now(), now: time.Now}
+}
+
+func (l *RateLimiter) Wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+	l.refill(l.now())
+	// reserve the tokens now, and sleep off any deficit
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if delay == 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// return the reservation, so later callers are not held back by it
+		l.mu.Lock()
+		l.tokens += float64(n)
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (l *RateLimiter) refill(now time.Time) {
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+}
+
+// Rate returns the current rate in operations per second
+func (l *RateLimiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// SetRate changes the rate, taking effect for subsequent operations
+func (l *RateLimiter) SetRate(rate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(l.now())
+	l.rate = rate
+}
+
+// AdaptiveLimiter is a RateLimiter which adjusts its rate to keep the observed latency of
+// operations near a target: the rate is cut multiplicatively while latency is above target, and
+// raised additively while below.
+type AdaptiveLimiter struct {
+	*RateLimiter
+	target           time.Duration
+	minRate, maxRate float64
+
+	mu         sync.Mutex
+	avg        float64 // moving average latency, in ns
+	lastAdjust time.Time
+}
+
+const (
+	adaptInterval = 100 * time.Millisecond
+	adaptDecrease = 0.75
+	adaptIncrease = 0.05 // fraction of max rate
+	latencyWeight = 0.1
+)
+
+// NewAdaptiveLimiter creates a limiter starting at maxRate operations per second, which adapts
+// within [minRate, maxRate] to keep latency near the target
+func NewAdaptiveLimiter(target time.Duration, minRate, maxRate float64, burst int) *AdaptiveLimiter {
+	return &AdaptiveLimiter{
+		RateLimiter: NewRateLimiter(maxRate, burst),
+		target:      target,
+		minRate:     minRate,
+		maxRate:     maxRate,
+		lastAdjust:  time.Now(),
+	}
+}
+
+// Observe records the latency of an operation, adjusting the rate at most once per interval
+func (a *AdaptiveLimiter) Observe(latency time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.avg == 0 {
+		a.avg = float64(latency)
+	} else {
+		a.avg += latencyWeight * (float64(latency) - a.avg)
+	}
+	now := a.now()
+	if now.Sub(a.lastAdjust) < adaptInterval {
+		return
+	}
+	a.lastAdjust = now
+	rate := a.Rate()
+	if a.avg > float64(a.target) {
+		rate *= adaptDecrease
+	} else {
+		rate += a.maxRate * adaptIncrease
+	}
+	if rate < a.minRate {
+		rate = a.minRate
+	}
+	if rate > a.maxRate {
+		rate = a.maxRate
+	}
+	a.SetRate(rate)
+}
+
+// latencyObserver is implemented by limiters which adapt to observed latency
+type latencyObserver interface {
+	Observe(time.Duration)
+}
+
+// ThrottledIterator paces the nodes yielded by an iterator
+type ThrottledIterator struct {
+	trie.NodeIterator
+	ctx     context.Context
+	limiter Limiter
+	err     error
+}
+
+func NewThrottledIterator(ctx context.Context, it trie.NodeIterator, limiter Limiter) *ThrottledIterator {
+	return &ThrottledIterator{NodeIterator: it, ctx: ctx, limiter: limiter}
+}
+
+func (it *ThrottledIterator) Next(descend bool) bool {
+	if it.err != nil {
+		return false
+	}
+	if it.err = it.limiter.Wait(it.ctx, 1); it.err != nil {
+		return false
+	}
+	return it.NodeIterator.Next(descend)
+}
+
+func (it *ThrottledIterator) Error() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.NodeIterator.Error()
+}
+
+// ThrottledStore paces the reads made from a key-value store. If the limiter is adaptive, it is
+// fed the latency of each read. Reads blocked on the limiter fail once the context is done. Open
+// tries over it with OpenTrieFromStore.
+type ThrottledStore struct {
+	ethdb.KeyValueStore
+	ctx     context.Context
+	limiter Limiter
+}
+
+func NewThrottledStore(ctx context.Context, db ethdb.KeyValueStore, limiter Limiter) *ThrottledStore {
+	return &ThrottledStore{KeyValueStore: db, ctx: ctx, limiter: limiter}
+}
+
+func (s *ThrottledStore) Get(key []byte) ([]byte, error) {
+	if err := s.limiter.Wait(s.ctx, 1); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	val, err := s.KeyValueStore.Get(key)
+	if obs, ok := s.limiter.(latencyObserver); ok {
+		obs.Observe(time.Since(start))
+	}
+	return val, err
+}
+
+func (s *ThrottledStore) Has(key []byte) (bool, error) {
+	if err := s.limiter.Wait(s.ctx, 1); err != nil {
+		return false, err
+	}
+	start := time.Now()
+	has, err := s.KeyValueStore.Has(key)
+	if obs, ok := s.limiter.(latencyObserver); ok {
+		obs.Observe(time.Since(start))
+	}
+	return has, err
+}
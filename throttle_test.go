@@ -0,0 +1,193 @@
+package iterator_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+)
+
+// counts permitted operations without limiting them
+type countingLimiter struct{ count int64 }
+
+func (l *countingLimiter) Wait(_ context.Context, n int) error {
+	atomic.AddInt64(&l.count, int64(n))
+	return nil
+}
+
+// a time source which only moves when advanced
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock { return &fakeClock{now: time.Unix(0, 0)} }
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// fails unless a wait returns without blocking
+func waitPromptly(t *testing.T, limiter iter.Limiter, n int) {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- limiter.Wait(context.Background(), n) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wait blocked")
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	// waits can only overrun, so only a lower bound is checked
+	limiter := iter.NewRateLimiter(200, 1)
+	start := time.Now()
+	for i := 0; i < 21; i++ {
+		if err := limiter.Wait(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("limiter too fast: 20 ops at 200/s took %v", elapsed)
+	}
+
+	// tokens are refilled as time passes, and not before
+	clock := newFakeClock()
+	limiter = iter.NewRateLimiter(0.1, 1)
+	limiter.SetClock(clock.Now)
+	for i := 0; i < 3; i++ {
+		waitPromptly(t, limiter, 1)
+		clock.Advance(10 * time.Second)
+	}
+	waitPromptly(t, limiter, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, have %v", err)
+	}
+
+	limiter = iter.NewRateLimiter(1, 1)
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.Wait(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, have %v", err)
+	}
+
+	// a cancelled wait returns its reservation, so the next token is ready on time
+	clock = newFakeClock()
+	limiter = iter.NewRateLimiter(0.1, 1)
+	limiter.SetClock(clock.Now)
+	waitPromptly(t, limiter, 1)
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx, 1000); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, have %v", err)
+	}
+	clock.Advance(10 * time.Second)
+	waitPromptly(t, limiter, 1)
+
+	limiter = iter.NewRateLimiter(0, 1)
+	for i := 0; i < 1000; i++ {
+		if err := limiter.Wait(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAdaptiveLimiter(t *testing.T) {
+	clock := newFakeClock()
+	limiter := iter.NewAdaptiveLimiter(time.Millisecond, 10, 1000, 1)
+	limiter.SetClock(clock.Now)
+	limiter.Observe(10 * time.Millisecond)
+	if rate := limiter.Rate(); rate != 1000 {
+		t.Fatalf("rate adjusted within an interval: %v", rate)
+	}
+	clock.Advance(100 * time.Millisecond)
+	limiter.Observe(10 * time.Millisecond)
+	if rate := limiter.Rate(); rate >= 1000 {
+		t.Fatalf("rate not reduced under high latency: %v", rate)
+	}
+	slowed := limiter.Rate()
+	for i := 0; i < 100; i++ {
+		limiter.Observe(time.Microsecond)
+	}
+	clock.Advance(100 * time.Millisecond)
+	limiter.Observe(time.Microsecond)
+	if rate := limiter.Rate(); rate <= slowed {
+		t.Fatalf("rate not raised under low latency: %v", rate)
+	}
+}
+
+func TestThrottledIteration(t *testing.T) {
+	_, tree := newTestTrie(t, 500, 1)
+	db, _, err := iter.CopyStateToMemory(tree, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reads := &countingLimiter{}
+	fac, err := iter.NewSubtrieIteratorFactoryFromStore(iter.NewThrottledStore(context.Background(), db, reads), tree.Hash(), 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := &countingLimiter{}
+	counter := iter.NewCountingSink()
+	runner := iter.NewSinkRunner(&fac, counter)
+	runner.Limiter = nodes
+	if err := runner.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if reads.count == 0 {
+		t.Fatal("no reads passed through the limiter")
+	}
+	if uint64(nodes.count) < counter.Nodes()+counter.Leaves() {
+		t.Fatalf("too few nodes passed through the limiter: %d", nodes.count)
+	}
+
+	// a cancelled context stops a throttled iterator
+	ctx, cancel := context.WithCancel(context.Background())
+	it := iter.NewThrottledIterator(ctx, fac.IteratorAt(0), iter.NewRateLimiter(1000, 1))
+	if !it.Next(true) {
+		t.Fatal("expected a node")
+	}
+	cancel()
+	if it.Next(true) {
+		t.Fatal("expected iteration to stop")
+	}
+	if !errors.Is(it.Error(), context.Canceled) {
+		t.Fatalf("expected cancellation error, have %v", it.Error())
+	}
+
+	// a cancelled context fails reads blocked on the limiter
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	limiter := iter.NewRateLimiter(1, 1)
+	store := iter.NewThrottledStore(ctx, db, limiter)
+	if _, err := store.Get(tree.Hash().Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(tree.Hash().Bytes()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, have %v", err)
+	}
+	if _, err := store.Has(tree.Hash().Bytes()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, have %v", err)
+	}
+}
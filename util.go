@@ -2,6 +2,9 @@ package iterator
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+
 	"github.com/ethereum/go-ethereum/trie"
 )
 
@@ -23,8 +26,21 @@ func CompareNodes(a, b trie.NodeIterator) int {
 	return 0
 }
 
+// Trie paths are dealt with in the three encodings used by go-ethereum's trie package:
+// KEYBYTES is the key itself; HEX has one byte per nibble, with an optional trailing terminator
+// (16) marking a leaf; COMPACT is the "hex prefix" encoding of the Yellow Paper used within nodes.
+
+var (
+	// ErrOddLengthPath is returned when converting a hex path of odd length to key bytes
+	ErrOddLengthPath = errors.New("hex path has odd length")
+	// ErrInvalidPath is returned for a hex path containing invalid nibbles
+	ErrInvalidPath = errors.New("invalid hex path")
+	// ErrInvalidCompact is returned when decoding an invalid compact encoding
+	ErrInvalidCompact = errors.New("invalid compact encoding")
+)
+
 // hexToKeyBytes turns hex nibbles into key bytes.
-// This can only be used for keys of even length.
+// This can only be used for keys of even length; see HexToKeyBytesE for a variant returning an error
 func HexToKeyBytes(hex []byte) []byte {
 	if hasTerm(hex) {
 		hex = hex[:len(hex)-1]
@@ -37,6 +53,103 @@ func HexToKeyBytes(hex []byte) []byte {
 	return key
 }
 
+// Like HexToKeyBytes, but returns an error for odd-length or invalid paths instead of panicking
+func HexToKeyBytesE(hex []byte) ([]byte, error) {
+	if err := ValidateHexPath(hex); err != nil {
+		return nil, err
+	}
+	if hasTerm(hex) {
+		hex = hex[:len(hex)-1]
+	}
+	if len(hex)&1 != 0 {
+		return nil, fmt.Errorf("%w: %d nibbles", ErrOddLengthPath, len(hex))
+	}
+	key := make([]byte, len(hex)/2)
+	decodeNibbles(hex, key)
+	return key, nil
+}
+
+// HexToKeyBytesPadded turns hex nibbles into key bytes, padding an odd-length path with a zero
+// nibble. The result is the smallest key within the subtrie at the path.
+func HexToKeyBytesPadded(hex []byte) []byte {
+	if hasTerm(hex) {
+		hex = hex[:len(hex)-1]
+	}
+	if len(hex)&1 != 0 {
+		hex = append(append(make([]byte, 0, len(hex)+1), hex...), 0)
+	}
+	key := make([]byte, len(hex)/2)
+	decodeNibbles(hex, key)
+	return key
+}
+
+// KeyBytesToHex turns key bytes into hex nibbles, with a terminator
+func KeyBytesToHex(key []byte) []byte {
+	return keybytesToHex(key)
+}
+
+// HexToCompact turns hex nibbles into the compact encoding
+func HexToCompact(hex []byte) []byte {
+	terminator := byte(0)
+	if hasTerm(hex) {
+		terminator = 1
+		hex = hex[:len(hex)-1]
+	}
+	buf := make([]byte, len(hex)/2+1)
+	buf[0] = terminator << 5 // the flag byte
+	if len(hex)&1 == 1 {
+		buf[0] |= 1 << 4 // odd flag
+		buf[0] |= hex[0] // first nibble is contained in the first byte
+		hex = hex[1:]
+	}
+	decodeNibbles(hex, buf[1:])
+	return buf
+}
+
+// CompactToHex turns a compact encoding into hex nibbles, validating its flags
+func CompactToHex(compact []byte) ([]byte, error) {
+	if len(compact) == 0 {
+		return nil, fmt.Errorf("%w: empty", ErrInvalidCompact)
+	}
+	flag := compact[0] >> 4
+	if flag > 3 {
+		return nil, fmt.Errorf("%w: flag %d", ErrInvalidCompact, flag)
+	}
+	if flag&1 == 0 && compact[0]&0xf != 0 {
+		return nil, fmt.Errorf("%w: nonzero padding", ErrInvalidCompact)
+	}
+	return compactToHex(compact), nil
+}
+
+// ValidateHexPath checks that a path contains only nibbles, with at most a trailing terminator
+func ValidateHexPath(hex []byte) error {
+	for i, n := range hex {
+		if n > 16 || (n == 16 && i != len(hex)-1) {
+			return fmt.Errorf("%w: byte %d at index %d", ErrInvalidPath, n, i)
+		}
+	}
+	return nil
+}
+
+// CommonPrefixLen returns the length of the common prefix of two paths
+func CommonPrefixLen(a, b []byte) int {
+	var i, length = 0, len(a)
+	if len(b) < length {
+		length = len(b)
+	}
+	for ; i < length; i++ {
+		if a[i] != b[i] {
+			break
+		}
+	}
+	return i
+}
+
+// HasPrefix reports whether a path begins with a prefix
+func HasPrefix(path, prefix []byte) bool {
+	return bytes.HasPrefix(path, prefix)
+}
+
 func decodeNibbles(nibbles []byte, bytes []byte) {
 	for bi, ni := 0, 0; ni < len(nibbles); bi, ni = bi+1, ni+2 {
 		bytes[bi] = nibbles[ni]<<4 | nibbles[ni+1]
@@ -47,3 +160,28 @@ func decodeNibbles(nibbles []byte, bytes []byte) {
 func hasTerm(s []byte) bool {
 	return len(s) > 0 && s[len(s)-1] == 16
 }
+
+func compactToHex(compact []byte) []byte {
+	if len(compact) == 0 {
+		return compact
+	}
+	base := keybytesToHex(compact)
+	// delete terminator flag
+	if base[0] < 2 {
+		base = base[:len(base)-1]
+	}
+	// apply odd flag
+	chop := 2 - base[0]&1
+	return base[chop:]
+}
+
+func keybytesToHex(str []byte) []byte {
+	l := len(str)*2 + 1
+	var nibbles = make([]byte, l)
+	for i, b := range str {
+		nibbles[i*2] = b / 16
+		nibbles[i*2+1] = b % 16
+	}
+	nibbles[l-1] = 16
+	return nibbles
+}
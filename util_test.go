@@ -0,0 +1,78 @@
+package iterator_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+)
+
+func TestPathCodec(t *testing.T) {
+	key := []byte{0x12, 0x3a, 0xbc}
+	hex := iter.KeyBytesToHex(key)
+	if !bytes.Equal(hex, []byte{1, 2, 3, 10, 11, 12, 16}) {
+		t.Fatalf("wrong hex encoding: %v", hex)
+	}
+	if decoded, err := iter.HexToKeyBytesE(hex); err != nil || !bytes.Equal(decoded, key) {
+		t.Fatalf("wrong key decoding: %x, %v", decoded, err)
+	}
+
+	for _, path := range [][]byte{{}, {1}, {1, 2}, {1, 2, 3, 16}, {0, 15, 16}, {16}} {
+		compact := iter.HexToCompact(path)
+		decoded, err := iter.CompactToHex(compact)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decoded, path) {
+			t.Errorf("compact round trip failed; expected %v, have %v", path, decoded)
+		}
+	}
+	for _, compact := range [][]byte{{}, {0x40}, {0x05}} {
+		if _, err := iter.CompactToHex(compact); !errors.Is(err, iter.ErrInvalidCompact) {
+			t.Errorf("expected ErrInvalidCompact for %x, have %v", compact, err)
+		}
+	}
+
+	if _, err := iter.HexToKeyBytesE([]byte{1, 2, 3}); !errors.Is(err, iter.ErrOddLengthPath) {
+		t.Errorf("expected ErrOddLengthPath, have %v", err)
+	}
+	if _, err := iter.HexToKeyBytesE([]byte{1, 16, 2}); !errors.Is(err, iter.ErrInvalidPath) {
+		t.Errorf("expected ErrInvalidPath, have %v", err)
+	}
+	if padded := iter.HexToKeyBytesPadded([]byte{1, 2, 3}); !bytes.Equal(padded, []byte{0x12, 0x30}) {
+		t.Errorf("wrong padded key: %x", padded)
+	}
+	if n := iter.CommonPrefixLen([]byte{1, 2, 3}, []byte{1, 2, 4, 5}); n != 2 {
+		t.Errorf("wrong common prefix length: %d", n)
+	}
+}
+
+func TestPath(t *testing.T) {
+	for _, s := range []string{"", "0", "3a4f", "ff#", "#"} {
+		path, err := iter.ParsePath(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if path.String() != s {
+			t.Errorf("wrong path string; expected %q, have %q", s, path)
+		}
+	}
+	if _, err := iter.ParsePath("3g"); !errors.Is(err, iter.ErrInvalidPath) {
+		t.Errorf("expected ErrInvalidPath, have %v", err)
+	}
+
+	path := iter.Path{3, 10, 4, 16}
+	if !path.IsLeaf() || len(path.Nibbles()) != 3 {
+		t.Errorf("wrong leaf handling for %s", path)
+	}
+	if !path.HasPrefix(iter.Path{3, 10}) || path.HasPrefix(iter.Path{3, 11}) {
+		t.Errorf("wrong prefix check for %s", path)
+	}
+	if common := path.CommonPrefix(iter.Path{3, 10, 5}); common.String() != "3a" {
+		t.Errorf("wrong common prefix: %s", common)
+	}
+	if _, err := path.KeyBytes(); !errors.Is(err, iter.ErrOddLengthPath) {
+		t.Errorf("expected ErrOddLengthPath, have %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+//
+// Copyright © 2022 Vulcanize, Inc
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package iterator
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// WitnessIterator collects the proofs of a set of leaf keys as it iterates. The proof nodes are
+// taken from the iterator's stack when each leaf is reached, so no node is read twice, and are
+// written to a proof database as keccak(node) => node, for use with trie.VerifyProof.
+//
+// Only keys present in the trie are proven; keys not reached by the iterator are reported by
+// Missing.
+type WitnessIterator struct {
+	trie.NodeIterator
+	proofDb ethdb.KeyValueWriter
+	wanted  map[string]bool // whether each key has been found
+	err     error
+}
+
+func NewWitnessIterator(it trie.NodeIterator, keys [][]byte, proofDb ethdb.KeyValueWriter) *WitnessIterator {
+	wanted := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		wanted[string(key)] = false
+	}
+	return &WitnessIterator{NodeIterator: it, proofDb: proofDb, wanted: wanted}
+}
+
+// WitnessIteratorAt returns an iterator over a bin which proves those of the keys within the bin
+func (fac *SubtrieIteratorFactory) WitnessIteratorAt(bin uint, keys [][]byte, proofDb ethdb.KeyValueWriter) *WitnessIterator {
+	origin, limit := binKeyBounds(PathRange{Start: fac.startPaths[bin], End: fac.endPaths[bin]})
+	var inBin [][]byte
+	for _, key := range keys {
+		if bytes.Compare(key, origin) >= 0 && bytes.Compare(key, limit) <= 0 {
+			inBin = append(inBin, key)
+		}
+	}
+	return NewWitnessIterator(fac.IteratorAt(bin), inBin, proofDb)
+}
+
+func (it *WitnessIterator) Next(descend bool) bool {
+	if it.err != nil || !it.NodeIterator.Next(descend) {
+		return false
+	}
+	if !it.Leaf() {
+		return true
+	}
+	key := string(it.LeafKey())
+	if found, has := it.wanted[key]; !has || found {
+		return true
+	}
+	it.wanted[key] = true
+	for _, node := range it.LeafProof() {
+		if it.err = it.proofDb.Put(crypto.Keccak256(node), node); it.err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (it *WitnessIterator) Error() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.NodeIterator.Error()
+}
+
+// Missing returns the keys which have not been found, in sorted order
+func (it *WitnessIterator) Missing() [][]byte {
+	var res [][]byte
+	for key, found := range it.wanted {
+		if !found {
+			res = append(res, []byte(key))
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return bytes.Compare(res[i], res[j]) < 0 })
+	return res
+}
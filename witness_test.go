@@ -0,0 +1,64 @@
+package iterator_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/trie"
+
+	iter "github.com/vulcanize/go-eth-state-node-iterator"
+)
+
+func TestWitnessIterator(t *testing.T) {
+	_, tree := newTestTrie(t, 500, 1)
+	var keys, values [][]byte
+	for it := trie.NewIterator(tree.NodeIterator(nil)); it.Next(); {
+		keys = append(keys, it.Key)
+		values = append(values, it.Value)
+	}
+	var wanted [][]byte
+	for i := 0; i < len(keys); i += 50 {
+		wanted = append(wanted, keys[i])
+	}
+	absent := append([]byte{}, keys[1]...)
+	absent[len(absent)-1]++
+	wanted = append(wanted, absent)
+
+	proofDb := memorydb.New()
+	fac := iter.NewSubtrieIteratorFactory(tree, 16)
+	var missing [][]byte
+	for b := uint(0); b < uint(fac.Length()); b++ {
+		it := fac.WitnessIteratorAt(b, wanted, proofDb)
+		for it.Next(true) {
+		}
+		if err := it.Error(); err != nil {
+			t.Fatal(err)
+		}
+		missing = append(missing, it.Missing()...)
+	}
+	if len(missing) != 1 || !bytes.Equal(missing[0], absent) {
+		t.Fatalf("wrong missing keys: %x", missing)
+	}
+
+	for i := 0; i < len(keys); i += 50 {
+		value, err := trie.VerifyProof(tree.Hash(), keys[i], proofDb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(value, values[i]) {
+			t.Fatalf("wrong value for key %x", keys[i])
+		}
+	}
+	// keys outside the witness can't be proven
+	if _, err := trie.VerifyProof(tree.Hash(), keys[1], proofDb); err == nil {
+		t.Fatal("expected unproven key to fail")
+	}
+	var total int
+	for it := tree.NodeIterator(nil); it.Next(true); {
+		total++
+	}
+	if proofDb.Len() >= total {
+		t.Fatalf("witness not minimal: %d of %d nodes", proofDb.Len(), total)
+	}
+}